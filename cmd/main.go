@@ -7,7 +7,9 @@ import (
 	"event-pipeline/internal/pipeline"
 	"event-pipeline/internal/storage"
 	"event-pipeline/pkg/logger"
+	"event-pipeline/pkg/processor"
 	"event-pipeline/pkg/validator"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,6 +18,16 @@ import (
 )
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		case "drain-spool":
+			os.Exit(runDrainSpool(os.Args[2:]))
+		}
+	}
+
 	// Initialize logger
 	logger.Init(os.Getenv("LOG_MODE") == "prod")
 	log := logger.Get()
@@ -29,6 +41,7 @@ func main() {
 		"queue_size", cfg.QueueSize,
 		"max_retries", cfg.MaxRetries,
 		"retry_backoff_ms", cfg.RetryBaseBackoff.Milliseconds(),
+		"dead_letter_sink", cfg.DeadLetterSink,
 	)
 
 	// Setup storage (MySQL)
@@ -43,16 +56,125 @@ func main() {
 		}
 	}()
 
+	// Setup dead letter store (mysql, file or none)
+	opts := []pipeline.Option{pipeline.WithRetryPolicy(retryPolicy(cfg))}
+	dlq, closeDLQ, err := openDeadLetters(cfg, store)
+	if err != nil {
+		log.Fatalw("failed to set up dead letters", "error", err)
+	}
+	defer closeDLQ()
+	if dlq != nil {
+		opts = append(opts, pipeline.WithDeadLetterSink(dlq))
+	}
+
+	// Events still queued when the shutdown deadline hits go to a local
+	// file, so a dead database cannot lose them
+	if cfg.SpillFile != "" {
+		spill, err := storage.NewFileDeadLetterSink(cfg.SpillFile)
+		if err != nil {
+			log.Fatalw("failed to open spill file", "error", err)
+		}
+		defer spill.Close()
+		opts = append(opts, pipeline.WithSpillSink(spill))
+	}
+
+	// Optional write-ahead log: accepted events survive a crash and are
+	// re-enqueued on the next start
+	if cfg.WALDir != "" {
+		wal, err := pipeline.OpenWAL(cfg.WALDir, int64(cfg.WALSegmentBytes), cfg.WALSync)
+		if err != nil {
+			log.Fatalw("failed to open wal", "error", err)
+		}
+		defer wal.Close()
+		opts = append(opts, pipeline.WithWAL(wal))
+	}
+
+	// Optional priority lanes: critical events overtake a flood of bulk
+	// ones instead of queueing behind them
+	if cfg.LanesFile != "" {
+		lanes, err := pipeline.LoadLanesConfig(cfg.LanesFile)
+		if err != nil {
+			log.Fatalw("failed to load lanes", "error", err)
+		}
+		opts = append(opts, pipeline.WithLanes(lanes))
+	}
+
 	// Init core components
 	metrics := pipeline.NewMetrics()
-	processor := &pipeline.JSONProcessor{}   // replace with real processor later
-	val := &validator.BasicValidator{}       // basic validation
-	p := pipeline.NewEventPipeline(store, processor, val, metrics, cfg)
-	defer p.Shutdown()
+	store.SetMetrics(metrics)
+	// Processing stages run in order; without any the chain passes events
+	// through unchanged
+	chain, reloaders, err := openProcessor(cfg, store, metrics)
+	if err != nil {
+		log.Fatalw("failed to set up processors", "error", err)
+	}
+	// Allowed event types, shared by validation and storage; an empty
+	// EVENT_TYPES accepts any type
+	var types *pipeline.EventTypes
+	if len(cfg.EventTypes) > 0 {
+		types = pipeline.NewEventTypes(cfg.EventTypes...)
+		store.SetEventTypes(types)
+		checkCtx, cancelCheck := context.WithTimeout(context.Background(), 5*time.Second)
+		if _, err := store.CheckEventTypes(checkCtx, types); err != nil {
+			log.Warnw("could not check event types against MySQL", "error", err)
+		}
+		cancelCheck()
+	}
+	val, schemas, valReloaders, err := openValidator(cfg, types)
+	if err != nil {
+		log.Fatalw("failed to set up validation", "error", err)
+	}
+	// reloaders are re-read on SIGHUP without a restart
+	reloaders = append(reloaders, valReloaders...)
+	if len(reloaders) > 0 {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				for _, r := range reloaders {
+					if err := r.Reload(); err != nil {
+						log.Errorw("reload failed, keeping previous configuration", "error", err)
+					}
+				}
+			}
+		}()
+	}
+	// Events go to MySQL, or to the sinks picked by ROUTES_FILE
+	sink, closeSinks, err := openStorage(cfg, store, metrics)
+	if err != nil {
+		log.Fatalw("failed to set up storage routes", "error", err)
+	}
+	defer closeSinks()
+	p := pipeline.NewEventPipeline(sink, chain, val, metrics, cfg, opts...)
+
+	// Optional autoscaler: grows the worker pool while the queue backs up
+	// or events get slow, and shrinks it while idle
+	var autoscaler *pipeline.Autoscaler
+	switch {
+	case cfg.AutoscaleInterval <= 0:
+	case cfg.PartitionKey != "":
+		log.Warnw("autoscaling is disabled in partitioned mode", "partition_key", cfg.PartitionKey)
+	default:
+		autoscaler = pipeline.NewAutoscaler(p, pipeline.AutoscaleConfig{
+			Interval:       cfg.AutoscaleInterval,
+			QueuePerWorker: cfg.AutoscaleQueuePerWorker,
+			Latency:        cfg.AutoscaleLatency,
+		})
+		autoscaler.Start()
+		min, max := p.WorkerBounds()
+		log.Infow("autoscaler started",
+			"interval_ms", cfg.AutoscaleInterval.Milliseconds(),
+			"min_workers", min,
+			"max_workers", max,
+		)
+	}
 
 	// Start API server
 	mux := http.NewServeMux()
 	server := api.NewServer(p)
+	server.DeadLetters = dlq
+	server.Schemas = schemas
+	server.Autoscaler = autoscaler
 	server.RegisterRoutes(mux)
 
 	srv := &http.Server{
@@ -82,6 +204,177 @@ func main() {
 		log.Errorw("server shutdown error", "error", err)
 	}
 
-	p.Shutdown()
-	log.Info("service stopped")
+	// keep the pool as it is while draining
+	if autoscaler != nil {
+		autoscaler.Stop()
+	}
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer drainCancel()
+
+	summary, err := p.Shutdown(drainCtx)
+	if err != nil {
+		log.Warnw("pipeline shutdown hit its deadline", "error", err)
+	}
+	log.Infow("service stopped",
+		"drained", summary.Drained,
+		"spilled", summary.Spilled,
+		"dropped", summary.Dropped,
+	)
+}
+
+// openDeadLetters builds the dead letter store selected by
+// DEAD_LETTER_SINK. A nil store means dead lettering is disabled.
+func openDeadLetters(cfg *config.Config, store *storage.MySQLStorage) (pipeline.DeadLetterStore, func(), error) {
+	switch cfg.DeadLetterSink {
+	case "mysql":
+		return storage.NewMySQLDeadLetterSink(store.DB()), func() {}, nil
+	case "file":
+		dlq, err := storage.NewFileDeadLetterSink(cfg.DeadLetterFile)
+		if err != nil {
+			return nil, func() {}, err
+		}
+		return dlq, func() { _ = dlq.Close() }, nil
+	case "", "none":
+		return nil, func() {}, nil
+	default:
+		return nil, func() {}, fmt.Errorf("unknown dead letter sink %q", cfg.DeadLetterSink)
+	}
+}
+
+// reloader is configuration re-read on SIGHUP.
+type reloader interface {
+	Reload() error
+}
+
+// openProcessor builds the processor chain from TRANSFORM_FILE,
+// ENRICH_FILE and SCRIPT_FILE, in that order. It also returns the stages
+// that reload on SIGHUP.
+func openProcessor(cfg *config.Config, store *storage.MySQLStorage, metrics *pipeline.Metrics) (*pipeline.ProcessorChain, []reloader, error) {
+	var reloaders []reloader
+	chain := pipeline.NewProcessorChain()
+	chain.SetMetrics(metrics)
+	if cfg.TransformFile != "" {
+		transform, err := processor.LoadTransform(cfg.TransformFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load transforms: %w", err)
+		}
+		chain.Append(pipeline.ChainStage{Name: "transform", Stage: transform, OnError: transform.OnError()})
+	}
+	if cfg.EnrichFile != "" {
+		enricher, err := processor.LoadEnricher(cfg.EnrichFile, store.DB())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load enrichment lookups: %w", err)
+		}
+		enricher.SetMetrics(metrics)
+		reloaders = append(reloaders, enricher)
+		chain.Append(pipeline.ChainStage{Name: "enrich", Stage: enricher, OnError: enricher.OnError()})
+	}
+	if cfg.ScriptFile != "" {
+		scripts, err := processor.LoadScripts(cfg.ScriptFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load scripts: %w", err)
+		}
+		chain.Append(pipeline.ChainStage{Name: "script", Stage: scripts, OnError: scripts.OnError()})
+	}
+	return chain, reloaders, nil
+}
+
+// openValidator builds the validator from SCHEMA_DIR and RULES_FILE on top
+// of the basic checks against types. It returns the schema registry, nil
+// without SCHEMA_DIR, and the validators that reload on SIGHUP.
+func openValidator(cfg *config.Config, types *pipeline.EventTypes) (pipeline.Validator, *validator.Registry, []reloader, error) {
+	var reloaders []reloader
+	var val pipeline.Validator = &validator.BasicValidator{Types: types} // basic validation
+	var schemas *validator.Registry
+	if cfg.SchemaDir != "" {
+		var err error
+		schemas, err = validator.NewRegistry(cfg.SchemaDir, cfg.SchemaCompat)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to load event schemas: %w", err)
+		}
+		schemaVal := validator.NewRegistryValidator(schemas)
+		schemaVal.RequireSchema = cfg.SchemaRequired
+		schemaVal.Types = types
+		val = schemaVal
+		reloaders = append(reloaders, schemaVal)
+	}
+	if cfg.RulesFile != "" {
+		rules, err := validator.NewRuleValidator(cfg.RulesFile)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to load validation rules: %w", err)
+		}
+		reloaders = append(reloaders, rules)
+		val = validator.NewChain(val, rules)
+	}
+	return val, schemas, reloaders, nil
+}
+
+// retryPolicy is the storage retry policy from MAX_RETRIES and
+// RETRY_*_BACKOFF_MS, classifying errors by their MySQL error code.
+func retryPolicy(cfg *config.Config) *pipeline.RetryPolicy {
+	policy := pipeline.NewRetryPolicy(cfg.MaxRetries, cfg.RetryBaseBackoff, cfg.RetryMaxBackoff)
+	policy.Classify = storage.ClassifyMySQLError
+	return policy
+}
+
+// openStorage builds the storage processed events are written to: MySQL,
+// or a router over the sinks in ROUTES_FILE. MySQL, and every routed sink
+// without a breaker of its own, sits behind the BREAKER_* circuit breaker.
+func openStorage(cfg *config.Config, store *storage.MySQLStorage, metrics *pipeline.Metrics) (pipeline.Storage, func(), error) {
+	rcfg, err := routerConfig(cfg)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	return openRoutes(cfg, rcfg, store, metrics)
+}
+
+// routerConfig is the storage layout openStorage builds, with the BREAKER_*
+// settings filled in for sinks that have no breaker of their own.
+func routerConfig(cfg *config.Config) (*storage.RouterConfig, error) {
+	breaker := storage.BreakerConfig{
+		Failures:      cfg.BreakerFailures,
+		OpenMS:        int(cfg.BreakerOpen.Milliseconds()),
+		HalfOpenCalls: cfg.BreakerHalfOpenCalls,
+		Fallback:      cfg.BreakerFallbackFile,
+	}
+	rcfg := &storage.RouterConfig{
+		Sinks:   map[string]storage.SinkConfig{"mysql": {Type: storage.SinkMySQL, MaxRetries: 1}},
+		Default: []string{"mysql"},
+	}
+	if cfg.RoutesFile != "" {
+		var err error
+		if rcfg, err = storage.LoadRouterConfig(cfg.RoutesFile); err != nil {
+			return nil, err
+		}
+	}
+	for name, sc := range rcfg.Sinks {
+		if sc.Breaker == nil {
+			sc.Breaker = &breaker
+			rcfg.Sinks[name] = sc
+		}
+	}
+	return rcfg, nil
+}
+
+func openRoutes(cfg *config.Config, rcfg *storage.RouterConfig, store *storage.MySQLStorage, metrics *pipeline.Metrics) (pipeline.Storage, func(), error) {
+	sinks, closeSinks, err := storage.OpenSinks(*rcfg, store)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	if cfg.RoutesFile == "" {
+		// the pipeline's own retries apply, no router needed
+		sink := sinks["mysql"]
+		if b, ok := sink.(*storage.Breaker); ok {
+			b.SetMetrics(metrics)
+		}
+		return sink, closeSinks, nil
+	}
+	router, err := storage.NewRouter(*rcfg, sinks)
+	if err != nil {
+		closeSinks()
+		return nil, func() {}, err
+	}
+	router.SetMetrics(metrics)
+	return router, closeSinks, nil
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/internal/storage"
+	"event-pipeline/pkg/logger"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runReplay implements `event-pipeline replay`: it re-injects dead letters
+// through a local pipeline that stores into the configured MySQL database,
+// and waits for the pipeline to drain before exiting.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	stage := fs.String("stage", "", "only replay dead letters from this stage (validation, processing, storage)")
+	eventType := fs.String("type", "", "only replay events of this type")
+	source := fs.String("source", "", "only replay events from this source")
+	since := fs.String("since", "", "only replay dead letters recorded at or after this RFC3339 time")
+	until := fs.String("until", "", "only replay dead letters recorded before this RFC3339 time")
+	limit := fs.Int("limit", 0, "replay at most this many dead letters (0 = no limit)")
+	includeReplayed := fs.Bool("include-replayed", false, "also replay dead letters that were already replayed")
+	dryRun := fs.Bool("dry-run", false, "list matching dead letters without replaying them")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	filter := pipeline.DeadLetterFilter{
+		Stage:           *stage,
+		Type:            *eventType,
+		Source:          *source,
+		Limit:           *limit,
+		IncludeReplayed: *includeReplayed,
+	}
+	var err error
+	if filter.Since, err = parseTimeFlag(*since); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -since: %v\n", err)
+		return 2
+	}
+	if filter.Until, err = parseTimeFlag(*until); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -until: %v\n", err)
+		return 2
+	}
+
+	logger.Init(os.Getenv("LOG_MODE") == "prod")
+	log := logger.Get()
+	cfg := config.Load()
+	// an offline replay should wait for the workers instead of failing fast
+	cfg.EnqueueTimeout = time.Minute
+
+	store, err := storage.NewMySQLStorage(cfg.DSN())
+	if err != nil {
+		log.Errorw("failed to connect to MySQL", "error", err)
+		return 1
+	}
+	defer store.Close()
+
+	dlq, closeDLQ, err := openDeadLetters(cfg, store)
+	if err != nil {
+		log.Errorw("failed to set up dead letters", "error", err)
+		return 1
+	}
+	defer closeDLQ()
+	if dlq == nil {
+		log.Error("replay needs a dead letter store, DEAD_LETTER_SINK is none")
+		return 1
+	}
+
+	metrics := pipeline.NewMetrics()
+	store.SetMetrics(metrics)
+	// replayed events get the same processing and validation as live ones,
+	// so redaction and the schemas apply to them too
+	chain, _, err := openProcessor(cfg, store, metrics)
+	if err != nil {
+		log.Errorw("failed to set up processors", "error", err)
+		return 1
+	}
+	var types *pipeline.EventTypes
+	if len(cfg.EventTypes) > 0 {
+		types = pipeline.NewEventTypes(cfg.EventTypes...)
+		store.SetEventTypes(types)
+	}
+	val, _, _, err := openValidator(cfg, types)
+	if err != nil {
+		log.Errorw("failed to set up validation", "error", err)
+		return 1
+	}
+	sink, closeSinks, err := openStorage(cfg, store, metrics)
+	if err != nil {
+		log.Errorw("failed to set up storage routes", "error", err)
+		return 1
+	}
+	defer closeSinks()
+	p := pipeline.NewEventPipeline(sink, chain, val, metrics, cfg,
+		pipeline.WithDeadLetterSink(dlq), pipeline.WithRetryPolicy(retryPolicy(cfg)))
+
+	res, err := p.Replay(context.Background(), dlq, filter, *dryRun)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	_, _ = p.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Errorw("replay failed", "error", err)
+		return 1
+	}
+
+	out := map[string]interface{}{
+		"result":           res,
+		"events_processed": metrics.GetProcessed(),
+		"events_failed":    metrics.GetFailed(),
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(out)
+	return 0
+}
+
+func parseTimeFlag(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
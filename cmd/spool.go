@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/internal/storage"
+	"event-pipeline/pkg/logger"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// spoolBatch is how many spooled events are stored per call.
+const spoolBatch = 100
+
+// runDrainSpool implements `event-pipeline drain-spool`: it stores the
+// events a breaker spooled to its fallback file while storage was down,
+// routed like live events, and rewrites the file with only the events that
+// still failed. Nothing may spool into the file meanwhile, so it is meant
+// to run while the service is stopped or every breaker is closed.
+func runDrainSpool(args []string) int {
+	logger.Init(os.Getenv("LOG_MODE") == "prod")
+	log := logger.Get()
+	cfg := config.Load()
+
+	fs := flag.NewFlagSet("drain-spool", flag.ContinueOnError)
+	path := fs.String("file", cfg.BreakerFallbackFile, "spool file to drain (default BREAKER_FALLBACK_FILE)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "no spool file: set -file or BREAKER_FALLBACK_FILE")
+		return 2
+	}
+
+	lines, err := readSpool(*path)
+	if err != nil {
+		log.Errorw("failed to read spool", "path", *path, "error", err)
+		return 1
+	}
+
+	store, err := storage.NewMySQLStorage(cfg.DSN())
+	if err != nil {
+		log.Errorw("failed to connect to MySQL", "error", err)
+		return 1
+	}
+	defer store.Close()
+
+	metrics := pipeline.NewMetrics()
+	store.SetMetrics(metrics)
+	if len(cfg.EventTypes) > 0 {
+		store.SetEventTypes(pipeline.NewEventTypes(cfg.EventTypes...))
+	}
+	rcfg, err := routerConfig(cfg)
+	if err != nil {
+		log.Errorw("failed to set up storage routes", "error", err)
+		return 1
+	}
+	// an open breaker must fail the event, not spool it again
+	for name, sc := range rcfg.Sinks {
+		if sc.Breaker != nil {
+			b := *sc.Breaker
+			b.Fallback = ""
+			sc.Breaker = &b
+			rcfg.Sinks[name] = sc
+		}
+	}
+	sink, closeSinks, err := openRoutes(cfg, rcfg, store, metrics)
+	if err != nil {
+		log.Errorw("failed to set up storage routes", "error", err)
+		return 1
+	}
+	defer closeSinks()
+
+	kept, stored := drainSpool(context.Background(), sink, lines)
+	if err := os.WriteFile(*path, bytes.Join(kept, nil), 0o644); err != nil {
+		log.Errorw("failed to rewrite spool", "path", *path, "error", err)
+		return 1
+	}
+
+	out := map[string]interface{}{
+		"file":   *path,
+		"stored": stored,
+		"kept":   len(kept),
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(out)
+	return 0
+}
+
+// readSpool returns the lines of a spool file, newline included.
+func readSpool(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		lines = append(lines, append(append([]byte(nil), scanner.Bytes()...), '\n'))
+	}
+	return lines, scanner.Err()
+}
+
+// drainSpool stores the spooled events and returns the lines of those that
+// were not stored, unreadable ones included, and how many were.
+func drainSpool(ctx context.Context, sink pipeline.Storage, lines [][]byte) ([][]byte, int) {
+	log := logger.Get().With("component", "drain_spool")
+
+	var kept [][]byte
+	stored := 0
+	batch := make([]pipeline.ProcessedEvent, 0, spoolBatch)
+	batchLines := make([][]byte, 0, spoolBatch)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := sink.Store(ctx, batch)
+		var batchErr *pipeline.BatchError
+		switch {
+		case err == nil:
+			stored += len(batch)
+		case errors.As(err, &batchErr):
+			for i := range batch {
+				if evErr, ok := batchErr.Failed[i]; ok {
+					log.Warnw("spooled event not stored", "event_id", batch[i].ID, "error", evErr)
+					kept = append(kept, batchLines[i])
+					continue
+				}
+				stored++
+			}
+		default:
+			log.Warnw("spooled batch not stored", "count", len(batch), "error", err)
+			kept = append(kept, batchLines...)
+		}
+		batch = batch[:0]
+		batchLines = batchLines[:0]
+	}
+
+	for _, line := range lines {
+		var ev pipeline.ProcessedEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			log.Warnw("keeping unreadable spool line", "error", err)
+			kept = append(kept, line)
+			continue
+		}
+		batch = append(batch, ev)
+		batchLines = append(batchLines, line)
+		if len(batch) == spoolBatch {
+			flush()
+		}
+	}
+	flush()
+	return kept, stored
+}
@@ -2,20 +2,69 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"event-pipeline/internal/pipeline"
 	"event-pipeline/pkg/logger"
+	"event-pipeline/pkg/validator"
+	"fmt"
 	"net/http"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type Server struct {
 	Pipeline *pipeline.EventPipeline
+
+	// DeadLetters backs the replay endpoint; nil disables it.
+	DeadLetters pipeline.DeadLetterStore
+
+	// Schemas backs the schema registry endpoints; nil disables them.
+	Schemas *validator.Registry
+
+	// Autoscaler is paused and resumed by /admin/workers; nil means the
+	// pool is only resized by hand.
+	Autoscaler *pipeline.Autoscaler
 }
 
 type BatchRequest struct {
 	Events []pipeline.Event `json:"events"`
 }
 
+// Per-item outcomes reported by /events/batch.
+const (
+	ItemAccepted  = "accepted"
+	ItemDuplicate = "duplicate"
+	ItemInvalid   = "invalid"
+	ItemRejected  = "rejected"
+)
+
+type BatchItemResult struct {
+	Index  int                   `json:"index"`
+	ID     string                `json:"id"`
+	Status string                `json:"status"`
+	Reason string                `json:"reason,omitempty"`
+	Fields []pipeline.FieldError `json:"fields,omitempty"`
+}
+
+// ValidationErrorResponse is the 422 body for an event that failed
+// validation at the edge.
+type ValidationErrorResponse struct {
+	Error  string                `json:"error"`
+	Fields []pipeline.FieldError `json:"fields"`
+}
+
+type BatchResponse struct {
+	Accepted int               `json:"accepted"`
+	Rejected int               `json:"rejected"`
+	Results  []BatchItemResult `json:"results"`
+}
+
+type ReplayRequest struct {
+	pipeline.DeadLetterFilter
+	DryRun bool `json:"dry_run"`
+}
+
 func NewServer(p *pipeline.EventPipeline) *Server {
 	return &Server{Pipeline: p}
 }
@@ -26,6 +75,10 @@ func (s *Server) RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("/events/batch", RequestIDMiddleware(http.HandlerFunc(s.handleBatchEvents)))
 	mux.Handle("/health", RequestIDMiddleware(http.HandlerFunc(s.handleHealth)))
 	mux.Handle("/metrics", RequestIDMiddleware(http.HandlerFunc(s.handleMetrics)))
+	mux.Handle("/admin/dead-letters/replay", RequestIDMiddleware(http.HandlerFunc(s.handleReplay)))
+	mux.Handle("/admin/workers", RequestIDMiddleware(http.HandlerFunc(s.handleWorkers)))
+	mux.Handle("/schemas", RequestIDMiddleware(http.HandlerFunc(s.handleSchemas)))
+	mux.Handle("/schemas/", RequestIDMiddleware(http.HandlerFunc(s.handleSchemas)))
 }
 
 func (s *Server) handleSingleEvent(w http.ResponseWriter, r *http.Request) {
@@ -46,7 +99,29 @@ func (s *Server) handleSingleEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.Pipeline.Ingest(ev)
+	if key := r.Header.Get(idempotencyHeader); key != "" && ev.ID == "" {
+		ev.ID = idempotentEventID(key, 0)
+	}
+
+	// reject what the workers would drop anyway, while the client listens
+	if err := s.Pipeline.Validate(r.Context(), ev); err != nil {
+		writeValidationError(w, err)
+		log.Warnw("event rejected: validation failed", "error", err, "status", http.StatusUnprocessableEntity)
+		return
+	}
+
+	err := s.Pipeline.Ingest(ev)
+	if errors.Is(err, pipeline.ErrDuplicate) {
+		// already accepted earlier, answer as if it was this request
+		w.WriteHeader(http.StatusAccepted)
+		log.Infow("duplicate event ignored", "event_id", ev.ID, "status", http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		status := writeIngestError(w, err)
+		log.Warnw("event rejected", "error", err, "status", status)
+		return
+	}
 	log.Infow("event accepted",
 		"event_id", ev.ID,
 		"type", ev.Type,
@@ -90,30 +165,157 @@ func (s *Server) handleBatchEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var ids []string
-	for _, ev := range req.Events {
-		ids = append(ids, ev.ID)
-		s.Pipeline.Ingest(ev)
+	key := r.Header.Get(idempotencyHeader)
+	resp := BatchResponse{Results: make([]BatchItemResult, 0, len(req.Events))}
+	var blockErr error // set once the pipeline pushes back, skips the rest
+	for i, ev := range req.Events {
+		if key != "" && ev.ID == "" {
+			ev.ID = idempotentEventID(key, i)
+		}
+		// a generated ID is reported back but never deduplicated
+		generated := ev.ID == ""
+		ev = pipeline.NewEvent(ev)
+		res := BatchItemResult{Index: i, ID: ev.ID}
+
+		if verr := s.Pipeline.Validate(r.Context(), ev); verr != nil {
+			res.Status = ItemInvalid
+			res.Reason = verr.Error()
+			res.Fields = fieldErrors(verr)
+			resp.Rejected++
+			resp.Results = append(resp.Results, res)
+			continue
+		}
+
+		err := blockErr
+		if err == nil {
+			ingest := s.Pipeline.Ingest
+			if generated {
+				ingest = s.Pipeline.IngestNew
+			}
+			err = ingest(ev)
+		}
+		switch {
+		case err == nil:
+			res.Status = ItemAccepted
+			resp.Accepted++
+		case errors.Is(err, pipeline.ErrDuplicate):
+			res.Status = ItemDuplicate
+			resp.Accepted++
+		case errors.Is(err, pipeline.ErrQueueFull), errors.Is(err, pipeline.ErrPipelineClosed):
+			blockErr = err
+			res.Status = ItemRejected
+			res.Reason = err.Error()
+			resp.Rejected++
+		default:
+			res.Status = ItemRejected
+			res.Reason = err.Error()
+			resp.Rejected++
+		}
+		resp.Results = append(resp.Results, res)
 	}
 
-	w.WriteHeader(http.StatusAccepted)
-	log.Infow("batch accepted",
+	// 202 as long as anything got in; the per-item results carry the rest
+	status := http.StatusAccepted
+	if blockErr != nil {
+		w.Header().Set("Retry-After", retryAfterSeconds)
+		if resp.Accepted == 0 {
+			status = ingestErrorStatus(blockErr)
+		}
+	} else if resp.Accepted == 0 && resp.Rejected > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+
+	log.Infow("batch handled",
 		"count", len(req.Events),
-		"event_ids", ids,
+		"accepted", resp.Accepted,
+		"rejected", resp.Rejected,
+		"status", status,
 		"duration_ms", time.Since(start).Milliseconds(),
 	)
 }
 
+// idempotencyHeader lets clients retry a request safely: events without
+// an explicit ID get one derived from the key, so a retried request
+// carries the same IDs and is deduplicated.
+const idempotencyHeader = "Idempotency-Key"
+
+// idempotencyNamespace scopes the name-based UUIDs derived from keys.
+var idempotencyNamespace = uuid.MustParse("6f1c3b0e-5a7d-4c1e-9b8f-2d4e6a8c0b1d")
+
+// idempotentEventID derives a stable event ID from an idempotency key and
+// the position of the event in the request.
+func idempotentEventID(key string, index int) string {
+	return uuid.NewSHA1(idempotencyNamespace, []byte(fmt.Sprintf("%s/%d", key, index))).String()
+}
+
+// fieldErrors extracts field-level violations from a validation error.
+// Validators that return plain errors yield a single entry without a field.
+func fieldErrors(err error) []pipeline.FieldError {
+	var verr *pipeline.ValidationError
+	if errors.As(err, &verr) {
+		return verr.Fields
+	}
+	return []pipeline.FieldError{{Message: err.Error()}}
+}
+
+func writeValidationError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(ValidationErrorResponse{
+		Error:  "validation failed",
+		Fields: fieldErrors(err),
+	})
+}
+
+// retryAfterSeconds is the back-off hint sent with 429/503 responses.
+const retryAfterSeconds = "1"
+
+// writeIngestError maps an Ingest error to an HTTP response and returns
+// the status code written.
+func writeIngestError(w http.ResponseWriter, err error) int {
+	status := ingestErrorStatus(err)
+	w.Header().Set("Retry-After", retryAfterSeconds)
+	http.Error(w, err.Error(), status)
+	return status
+}
+
+func ingestErrorStatus(err error) int {
+	if errors.Is(err, pipeline.ErrQueueFull) {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusServiceUnavailable
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	rid := GetRequestID(r.Context())
 	log := logger.Get().With("request_id", rid)
 
-	healthy := s.Pipeline.Context().Err() == nil
+	state := s.Pipeline.State()
+	healthy := state == pipeline.StateRunning
 	w.Header().Set("Content-Type", "application/json")
-	resp := map[string]bool{"healthy": healthy}
+	// not ready while starting or draining, so load balancers stop routing here
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	resp := map[string]interface{}{"healthy": healthy, "state": state.String()}
+	// an open breaker means events are spooled or failing fast, not that
+	// this instance should stop taking traffic
+	if breakers := s.Pipeline.Metrics().BreakerStats(); len(breakers) > 0 {
+		states := make(map[string]string, len(breakers))
+		degraded := false
+		for name, st := range breakers {
+			states[name] = st.State
+			degraded = degraded || st.State != "closed"
+		}
+		resp["storage"] = states
+		resp["degraded"] = degraded
+	}
 	_ = json.NewEncoder(w).Encode(resp)
 
-	log.Debugw("health check", "path", r.URL.Path, "remote_addr", r.RemoteAddr, "healthy", healthy)
+	log.Debugw("health check", "path", r.URL.Path, "remote_addr", r.RemoteAddr, "healthy", healthy, "state", state.String())
 }
 
 func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
@@ -124,8 +326,23 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		"events_received":            s.Pipeline.Metrics().GetReceived(),
 		"events_processed":           s.Pipeline.Metrics().GetProcessed(),
 		"events_failed":              s.Pipeline.Metrics().GetFailed(),
+		"storage_batches":            s.Pipeline.Metrics().GetBatches(),
+		"events_dead_lettered":       s.Pipeline.Metrics().GetDeadLettered(),
+		"events_rejected":            s.Pipeline.Metrics().GetRejected(),
+		"events_spilled":             s.Pipeline.Metrics().GetSpilled(),
+		"events_recovered":           s.Pipeline.Metrics().GetRecovered(),
+		"duplicates_dropped":         s.Pipeline.Metrics().GetDuplicates(),
+		"events_filtered":            s.Pipeline.Metrics().GetFiltered(),
+		"storage_retries":            s.Pipeline.Metrics().GetRetries(),
+		"processor_stages":           s.Pipeline.Metrics().StageStats(),
+		"enrichment_lookups":         s.Pipeline.Metrics().LookupStats(),
+		"storage_sinks":              s.Pipeline.Metrics().SinkStats(),
+		"circuit_breakers":           s.Pipeline.Metrics().BreakerStats(),
 		"average_processing_latency": s.Pipeline.Metrics().AvgLatencyMS(),
-		"current_queue_depth":        len(s.Pipeline.Queue()),
+		"current_queue_depth":        s.Pipeline.QueueDepth(),
+		"queue_lanes":                s.Pipeline.LaneStats(),
+		"queue_partitions":           s.Pipeline.PartitionDepths(),
+		"retry_queue_depth":          s.Pipeline.RetryQueueDepth(),
 		"active_workers":             s.Pipeline.WorkerCount(),
 		"uptime_seconds":             int(time.Since(s.Pipeline.StartTime()).Seconds()),
 		"events_per_second":          s.Pipeline.Metrics().EPS(),
@@ -140,3 +357,45 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		"metrics", metrics,
 	)
 }
+
+func (s *Server) handleReplay(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rid := GetRequestID(r.Context())
+	log := logger.Get().With("request_id", rid)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		log.Warnw("request rejected", "method", r.Method, "path", r.URL.Path, "status", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.DeadLetters == nil {
+		http.Error(w, "dead letter store not configured", http.StatusNotImplemented)
+		log.Warnw("replay rejected: no dead letter store", "status", http.StatusNotImplemented)
+		return
+	}
+
+	var req ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		log.Warnw("invalid JSON body", "error", err, "status", http.StatusBadRequest)
+		return
+	}
+
+	res, err := s.Pipeline.Replay(r.Context(), s.DeadLetters, req.DeadLetterFilter, req.DryRun)
+	if err != nil {
+		http.Error(w, "replay failed", http.StatusInternalServerError)
+		log.Errorw("replay failed", "error", err, "status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+
+	log.Infow("replay completed",
+		"dry_run", res.DryRun,
+		"matched", res.Matched,
+		"replayed", res.Replayed,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+}
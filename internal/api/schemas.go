@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"event-pipeline/pkg/logger"
+	"event-pipeline/pkg/validator"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RegisterSchemaRequest is the body of POST /schemas/{type}.
+type RegisterSchemaRequest struct {
+	Schema json.RawMessage `json:"schema"`
+	// Compatibility overrides the registry default for this registration.
+	Compatibility string `json:"compatibility,omitempty"`
+}
+
+// SchemaTypeSummary is one entry of GET /schemas.
+type SchemaTypeSummary struct {
+	Type     string `json:"type"`
+	Versions []int  `json:"versions"`
+	Latest   int    `json:"latest"`
+}
+
+// SchemaConflictResponse is the 409 body for an incompatible schema.
+type SchemaConflictResponse struct {
+	Error   string   `json:"error"`
+	Reasons []string `json:"reasons"`
+}
+
+// handleSchemas serves the registry:
+//
+//	GET  /schemas                               types and their versions
+//	GET  /schemas/{type}                        every version of a type
+//	POST /schemas/{type}                        register the next version
+//	GET  /schemas/{type}/versions/{n|latest}    one version
+func (s *Server) handleSchemas(w http.ResponseWriter, r *http.Request) {
+	rid := GetRequestID(r.Context())
+	log := logger.Get().With("request_id", rid)
+
+	if s.Schemas == nil {
+		http.Error(w, "schema registry not configured", http.StatusNotImplemented)
+		log.Warnw("schema request rejected: no registry", "path", r.URL.Path, "status", http.StatusNotImplemented)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/schemas"), "/"), "/")
+	switch {
+	case parts[0] == "":
+		s.listSchemaTypes(w, r)
+	case len(parts) == 1:
+		s.handleSchemaType(w, r, parts[0])
+	case len(parts) == 3 && parts[1] == "versions":
+		s.getSchemaVersion(w, r, parts[0], parts[2])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) listSchemaTypes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	summaries := []SchemaTypeSummary{}
+	for _, t := range s.Schemas.Types() {
+		versions, err := s.Schemas.Versions(t)
+		if err != nil {
+			continue
+		}
+		sum := SchemaTypeSummary{Type: t}
+		for _, v := range versions {
+			sum.Versions = append(sum.Versions, v.Version)
+		}
+		sum.Latest = sum.Versions[len(sum.Versions)-1]
+		summaries = append(summaries, sum)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"types": summaries})
+}
+
+func (s *Server) handleSchemaType(w http.ResponseWriter, r *http.Request, eventType string) {
+	switch r.Method {
+	case http.MethodGet:
+		versions, err := s.Schemas.Versions(eventType)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"type": eventType, "versions": versions})
+	case http.MethodPost:
+		s.registerSchema(w, r, eventType)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) registerSchema(w http.ResponseWriter, r *http.Request, eventType string) {
+	log := logger.Get().With("request_id", GetRequestID(r.Context()))
+
+	var req RegisterSchemaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Schema) == 0 {
+		http.Error(w, "invalid JSON: expected {\"schema\": {...}}", http.StatusBadRequest)
+		log.Warnw("invalid schema registration body", "error", err, "status", http.StatusBadRequest)
+		return
+	}
+
+	v, err := s.Schemas.Register(eventType, req.Schema, req.Compatibility)
+	var cerr *validator.CompatibilityError
+	switch {
+	case errors.As(err, &cerr):
+		writeJSON(w, http.StatusConflict, SchemaConflictResponse{Error: cerr.Error(), Reasons: cerr.Reasons})
+		log.Warnw("schema rejected as incompatible",
+			"type", eventType,
+			"compatibility", cerr.Mode,
+			"reasons", cerr.Reasons,
+			"status", http.StatusConflict,
+		)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Warnw("schema rejected", "type", eventType, "error", err, "status", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, v)
+}
+
+func (s *Server) getSchemaVersion(w http.ResponseWriter, r *http.Request, eventType, version string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n := 0
+	if version != "latest" {
+		var err error
+		n, err = strconv.Atoi(version)
+		if err != nil || n < 1 {
+			http.Error(w, "version must be a positive integer or \"latest\"", http.StatusBadRequest)
+			return
+		}
+	}
+
+	v, err := s.Schemas.Get(eventType, n)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
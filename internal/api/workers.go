@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/logger"
+	"net/http"
+)
+
+// Autoscaler states reported by /admin/workers.
+const (
+	AutoscaleOn     = "on"
+	AutoscalePaused = "paused"
+	AutoscaleOff    = "off"
+)
+
+// WorkersRequest is the body of POST /admin/workers. Setting Workers
+// pauses the autoscaler unless Autoscale is true in the same request;
+// Autoscale alone pauses or resumes it.
+type WorkersRequest struct {
+	Workers   *int  `json:"workers,omitempty"`
+	Autoscale *bool `json:"autoscale,omitempty"`
+}
+
+// WorkersResponse is the worker pool state returned by /admin/workers.
+type WorkersResponse struct {
+	Workers   int    `json:"workers"`
+	Min       int    `json:"min"`
+	Max       int    `json:"max"`
+	Autoscale string `json:"autoscale"`
+}
+
+// handleWorkers reads or resizes the worker pool:
+//
+//	GET  /admin/workers    pool size, bounds and autoscaler state
+//	POST /admin/workers    {"workers": 8} and/or {"autoscale": true}
+func (s *Server) handleWorkers(w http.ResponseWriter, r *http.Request) {
+	rid := GetRequestID(r.Context())
+	log := logger.Get().With("request_id", rid)
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.workersState())
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		log.Warnw("request rejected", "method", r.Method, "path", r.URL.Path, "status", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req WorkersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		log.Warnw("invalid JSON body", "error", err, "status", http.StatusBadRequest)
+		return
+	}
+	if req.Workers == nil && req.Autoscale == nil {
+		http.Error(w, "workers or autoscale required", http.StatusBadRequest)
+		return
+	}
+	if req.Autoscale != nil && s.Autoscaler == nil {
+		http.Error(w, "autoscaler not configured", http.StatusNotImplemented)
+		log.Warnw("autoscale request rejected: no autoscaler", "status", http.StatusNotImplemented)
+		return
+	}
+
+	if req.Workers != nil {
+		prev, err := s.Pipeline.SetWorkerCount(*req.Workers)
+		if err != nil {
+			status := http.StatusBadRequest
+			switch {
+			case errors.Is(err, pipeline.ErrFixedWorkers):
+				status = http.StatusConflict
+			case errors.Is(err, pipeline.ErrPipelineClosed):
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, err.Error(), status)
+			log.Warnw("worker resize rejected", "workers", *req.Workers, "error", err, "status", status)
+			return
+		}
+		log.Infow("worker pool resized by admin", "from", prev, "to", *req.Workers)
+		// a manual count would be undone on the next tick otherwise
+		if s.Autoscaler != nil && req.Autoscale == nil {
+			s.Autoscaler.Pause()
+		}
+	}
+	if req.Autoscale != nil {
+		if *req.Autoscale {
+			s.Autoscaler.Resume()
+		} else {
+			s.Autoscaler.Pause()
+		}
+		log.Infow("autoscaler toggled by admin", "enabled", *req.Autoscale)
+	}
+
+	writeJSON(w, http.StatusOK, s.workersState())
+}
+
+func (s *Server) workersState() WorkersResponse {
+	min, max := s.Pipeline.WorkerBounds()
+	state := AutoscaleOff
+	if s.Autoscaler != nil {
+		state = AutoscaleOn
+		if s.Autoscaler.Paused() {
+			state = AutoscalePaused
+		}
+	}
+	return WorkersResponse{
+		Workers:   s.Pipeline.WorkerCount(),
+		Min:       min,
+		Max:       max,
+		Autoscale: state,
+	}
+}
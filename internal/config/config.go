@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,8 +16,48 @@ type Config struct {
 	DBName           string
 	WorkerCount      int
 	QueueSize        int
+	EnqueueTimeout   time.Duration
 	MaxRetries       int
 	RetryBaseBackoff time.Duration
+	RetryMaxBackoff  time.Duration
+	BatchSize        int
+	BatchLinger      time.Duration
+	DeadLetterSink   string
+	DeadLetterFile   string
+	SpillFile        string
+	ShutdownTimeout  time.Duration
+	WALDir           string
+	WALSegmentBytes  int
+	WALSync          bool
+	DedupTTL         time.Duration
+	DedupMaxKeys     int
+	SchemaDir        string
+	SchemaRequired   bool
+	SchemaCompat     string
+	RulesFile        string
+	EventTypes       []string
+	TransformFile    string
+	ScriptFile       string
+	EnrichFile       string
+	RoutesFile       string
+	LanesFile        string
+	// PartitionKey enables the partitioned worker mode: user_id, source,
+	// type or a Data field. Empty keeps the shared queue.
+	PartitionKey string
+
+	// circuit breaker around storage; BreakerFailures <= 0 disables it
+	BreakerFailures      int
+	BreakerOpen          time.Duration
+	BreakerHalfOpenCalls int
+	BreakerFallbackFile  string
+
+	// worker pool bounds for manual and automatic scaling;
+	// AutoscaleInterval <= 0 disables the autoscaler
+	WorkersMin              int
+	WorkersMax              int
+	AutoscaleInterval       time.Duration
+	AutoscaleQueuePerWorker int
+	AutoscaleLatency        time.Duration
 }
 
 func Load() *Config {
@@ -28,8 +69,43 @@ func Load() *Config {
 		DBName:           getEnv("MYSQL_DATABASE", "eventdb"),
 		WorkerCount:      getEnvInt("WORKER_COUNT", 4),
 		QueueSize:        getEnvInt("QUEUE_SIZE", 1000),
+		EnqueueTimeout:   getEnvDuration("ENQUEUE_TIMEOUT_MS", 100*time.Millisecond),
 		MaxRetries:       getEnvInt("MAX_RETRIES", 3),
 		RetryBaseBackoff: getEnvDuration("RETRY_BASE_BACKOFF_MS", 20*time.Millisecond),
+		RetryMaxBackoff:  getEnvDuration("RETRY_MAX_BACKOFF_MS", 2*time.Second),
+		BatchSize:        getEnvInt("BATCH_SIZE", 1),
+		BatchLinger:      getEnvDuration("BATCH_LINGER_MS", 20*time.Millisecond),
+		DeadLetterSink:   getEnv("DEAD_LETTER_SINK", "mysql"),
+		DeadLetterFile:   getEnv("DEAD_LETTER_FILE", "dead_letters.jsonl"),
+		SpillFile:        getEnv("SPILL_FILE", "spilled_events.jsonl"),
+		ShutdownTimeout:  getEnvDuration("SHUTDOWN_TIMEOUT_MS", 30*time.Second),
+		WALDir:           getEnv("WAL_DIR", ""),
+		WALSegmentBytes:  getEnvInt("WAL_SEGMENT_BYTES", 64<<20),
+		WALSync:          getEnvBool("WAL_SYNC", true),
+		DedupTTL:         getEnvDuration("DEDUP_TTL_MS", 10*time.Minute),
+		DedupMaxKeys:     getEnvInt("DEDUP_MAX_KEYS", 100000),
+		SchemaDir:        getEnv("SCHEMA_DIR", ""),
+		SchemaRequired:   getEnvBool("SCHEMA_REQUIRED", false),
+		SchemaCompat:     getEnv("SCHEMA_COMPATIBILITY", "backward"),
+		RulesFile:        getEnv("RULES_FILE", ""),
+		TransformFile:    getEnv("TRANSFORM_FILE", ""),
+		ScriptFile:       getEnv("SCRIPT_FILE", ""),
+		EnrichFile:       getEnv("ENRICH_FILE", ""),
+		RoutesFile:       getEnv("ROUTES_FILE", ""),
+		LanesFile:        getEnv("LANES_FILE", ""),
+		PartitionKey:     getEnv("PARTITION_KEY", ""),
+		EventTypes:       getEnvList("EVENT_TYPES", []string{"user_action", "sensor_data", "system_log"}),
+
+		BreakerFailures:      getEnvInt("BREAKER_FAILURES", 5),
+		BreakerOpen:          getEnvDuration("BREAKER_OPEN_MS", 30*time.Second),
+		BreakerHalfOpenCalls: getEnvInt("BREAKER_HALF_OPEN_CALLS", 1),
+		BreakerFallbackFile:  getEnv("BREAKER_FALLBACK_FILE", ""),
+
+		WorkersMin:              getEnvInt("WORKERS_MIN", 1),
+		WorkersMax:              getEnvInt("WORKERS_MAX", 32),
+		AutoscaleInterval:       getEnvDuration("AUTOSCALE_INTERVAL_MS", 0),
+		AutoscaleQueuePerWorker: getEnvInt("AUTOSCALE_QUEUE_PER_WORKER", 50),
+		AutoscaleLatency:        getEnvDuration("AUTOSCALE_LATENCY_MS", 500*time.Millisecond),
 	}
 }
 
@@ -54,6 +130,30 @@ func getEnvInt(key string, fallback int) int {
 	return fallback
 }
 
+func getEnvBool(key string, fallback bool) bool {
+	if val, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+// getEnvList reads a comma separated list; an empty value means no items.
+func getEnvList(key string, fallback []string) []string {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	var out []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func getEnvDuration(key string, fallback time.Duration) time.Duration {
 	if val, ok := os.LookupEnv(key); ok {
 		if i, err := strconv.Atoi(val); err == nil {
@@ -0,0 +1,239 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"event-pipeline/pkg/logger"
+)
+
+// ErrFixedWorkers is returned by SetWorkerCount in the partitioned mode,
+// where every worker owns a partition of the keys.
+var ErrFixedWorkers = errors.New("worker count is fixed in partitioned mode")
+
+// ErrWorkerBounds is returned by SetWorkerCount for a count outside
+// WorkerBounds.
+var ErrWorkerBounds = errors.New("worker count out of bounds")
+
+// WorkerBounds is the range the pool can be resized in: WorkersMin and
+// WorkersMax, widened to include the initial WorkerCount.
+func (p *EventPipeline) WorkerBounds() (min, max int) {
+	min, max = p.cfg.WorkersMin, p.cfg.WorkersMax
+	if min < 1 {
+		min = 1
+	}
+	if n := p.cfg.WorkerCount; n > 0 && min > n {
+		min = n
+	}
+	if max < p.cfg.WorkerCount {
+		max = p.cfg.WorkerCount
+	}
+	if max < min {
+		max = min
+	}
+	return min, max
+}
+
+// SetWorkerCount grows or shrinks the worker pool to n and returns the
+// previous size. New workers start right away; removed workers finish the
+// event they hold and then exit, nothing they would have picked up is
+// lost. It fails once Shutdown has started.
+func (p *EventPipeline) SetWorkerCount(n int) (int, error) {
+	if p.partitions != nil {
+		return p.WorkerCount(), ErrFixedWorkers
+	}
+	if min, max := p.WorkerBounds(); n < min || n > max {
+		return p.WorkerCount(), fmt.Errorf("%w: %d not in [%d, %d]", ErrWorkerBounds, n, min, max)
+	}
+
+	// Shutdown waits on the workers' WaitGroups once draining starts, so
+	// the pool must not change after that
+	p.ingestMu.RLock()
+	defer p.ingestMu.RUnlock()
+	if p.state.Load() != StateRunning {
+		return p.WorkerCount(), ErrPipelineClosed
+	}
+
+	p.workersMu.Lock()
+	defer p.workersMu.Unlock()
+	prev := len(p.workerPool)
+	for len(p.workerPool) < n {
+		p.startWorker(p.ingestionChan)
+	}
+	for len(p.workerPool) > n {
+		last := len(p.workerPool) - 1
+		w := p.workerPool[last]
+		p.workerPool[last] = nil
+		p.workerPool = p.workerPool[:last]
+		close(w.quit)
+		logger.Get().Infow("worker stopping", "worker_id", w.id)
+	}
+	if prev != n {
+		logger.Get().Infow("worker pool resized", "from", prev, "to", n)
+	}
+	return prev, nil
+}
+
+// startWorker adds a worker reading jobs to the pool. The caller holds
+// workersMu.
+func (p *EventPipeline) startWorker(jobs <-chan Event) {
+	p.lastWorkerID++
+	w := &Worker{
+		id:        p.lastWorkerID,
+		jobChan:   jobs,
+		retryChan: p.retries.ready,
+		pipeline:  p,
+		wg:        &p.wg,
+		drained:   &p.drained,
+		quit:      make(chan struct{}),
+	}
+	p.workerPool = append(p.workerPool, w)
+	w.Start(p.workCtx)
+	logger.Get().Infow("worker started", "worker_id", w.id)
+}
+
+// AutoscaleConfig drives an Autoscaler. The pool stays within the
+// pipeline's WorkerBounds.
+type AutoscaleConfig struct {
+	Interval time.Duration
+	// QueuePerWorker grows the pool while more events than this wait per
+	// worker.
+	QueuePerWorker int
+	// Latency grows the pool while events processed during the last
+	// interval took longer than this on average; 0 ignores latency.
+	Latency time.Duration
+}
+
+// Autoscaler resizes a pipeline's worker pool every interval from the
+// queue depth and the recent processing latency. It grows by half the
+// pool at a time when the queue backs up or events get slow, and shrinks
+// by one worker while the queue is empty and latency is low, so a burst is
+// absorbed quickly and capacity is given back gradually.
+type Autoscaler struct {
+	pipeline *EventPipeline
+	cfg      AutoscaleConfig
+
+	mu            sync.Mutex
+	paused        bool
+	lastProcessed uint64
+	lastLatencyMS uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewAutoscaler(p *EventPipeline, cfg AutoscaleConfig) *Autoscaler {
+	if cfg.QueuePerWorker < 1 {
+		cfg.QueuePerWorker = 1
+	}
+	return &Autoscaler{
+		pipeline:      p,
+		cfg:           cfg,
+		lastProcessed: p.metrics.GetProcessed(),
+		lastLatencyMS: p.metrics.GetTotalLatencyMS(),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+func (a *Autoscaler) Start() {
+	go a.run()
+}
+
+// Stop ends the scaling loop; the pool keeps its current size.
+func (a *Autoscaler) Stop() {
+	close(a.stop)
+	<-a.done
+}
+
+// Pause stops automatic resizing, e.g. while an operator set the worker
+// count by hand, until Resume.
+func (a *Autoscaler) Pause() {
+	a.mu.Lock()
+	a.paused = true
+	a.mu.Unlock()
+}
+
+func (a *Autoscaler) Resume() {
+	a.mu.Lock()
+	a.paused = false
+	a.mu.Unlock()
+}
+
+func (a *Autoscaler) Paused() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.paused
+}
+
+func (a *Autoscaler) run() {
+	defer close(a.done)
+	if a.cfg.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !a.Paused() {
+				a.Step()
+			}
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// Step makes one scaling decision from what happened since the previous
+// one and returns the resulting worker count.
+func (a *Autoscaler) Step() int {
+	p := a.pipeline
+	a.mu.Lock()
+	processed, latencyMS := p.metrics.GetProcessed(), p.metrics.GetTotalLatencyMS()
+	events := processed - a.lastProcessed
+	var avg time.Duration
+	if events > 0 {
+		avg = time.Duration((latencyMS-a.lastLatencyMS)/events) * time.Millisecond
+	}
+	a.lastProcessed, a.lastLatencyMS = processed, latencyMS
+	a.mu.Unlock()
+
+	n := p.WorkerCount()
+	depth := p.QueueDepth()
+	slow := a.cfg.Latency > 0 && events > 0 && avg > a.cfg.Latency
+	fast := a.cfg.Latency <= 0 || events == 0 || avg < a.cfg.Latency/2
+
+	target := n
+	switch {
+	case depth > a.cfg.QueuePerWorker*n || slow:
+		target = n + (n+1)/2
+	case depth == 0 && fast:
+		target = n - 1
+	}
+	min, max := p.WorkerBounds()
+	if target < min {
+		target = min
+	}
+	if target > max {
+		target = max
+	}
+	if target == n {
+		return n
+	}
+
+	if _, err := p.SetWorkerCount(target); err != nil {
+		logger.Get().Warnw("autoscale failed", "workers", n, "target", target, "error", err)
+		return n
+	}
+	logger.Get().Infow("autoscaled worker pool",
+		"from", n,
+		"to", target,
+		"queue_depth", depth,
+		"avg_latency_ms", avg.Milliseconds(),
+	)
+	return target
+}
@@ -0,0 +1,130 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"event-pipeline/pkg/logger"
+)
+
+// batchItem is a processed event waiting to be flushed, together with the
+// time its processing started so end-to-end latency can be recorded.
+type batchItem struct {
+	event ProcessedEvent
+	start time.Time
+}
+
+// BatchWriter sits between the workers and Storage. It accumulates
+// processed events and writes them with a single Store call once the
+// batch reaches its size limit or the oldest event has lingered long enough.
+type BatchWriter struct {
+	pipeline *EventPipeline
+	size     int
+	linger   time.Duration
+	in       chan batchItem
+	done     chan struct{}
+}
+
+func newBatchWriter(p *EventPipeline, size int, linger time.Duration) *BatchWriter {
+	if linger <= 0 {
+		linger = 20 * time.Millisecond
+	}
+	return &BatchWriter{
+		pipeline: p,
+		size:     size,
+		linger:   linger,
+		in:       make(chan batchItem, size),
+		done:     make(chan struct{}),
+	}
+}
+
+// Add queues a processed event for the next flush.
+func (b *BatchWriter) Add(ev ProcessedEvent, start time.Time) {
+	b.in <- batchItem{event: ev, start: start}
+}
+
+func (b *BatchWriter) Start(ctx context.Context) {
+	go b.run(ctx)
+}
+
+// Close flushes whatever is pending and waits for the writer to exit.
+// It must only be called once all workers have stopped calling Add.
+func (b *BatchWriter) Close() {
+	close(b.in)
+	<-b.done
+}
+
+func (b *BatchWriter) run(ctx context.Context) {
+	defer close(b.done)
+
+	batch := make([]batchItem, 0, b.size)
+	timer := time.NewTimer(b.linger)
+	timer.Stop()
+	var lingerC <-chan time.Time
+
+	flush := func(reason string) {
+		if len(batch) == 0 {
+			return
+		}
+		b.flush(ctx, batch, reason)
+		batch = make([]batchItem, 0, b.size)
+	}
+
+	for {
+		select {
+		case item, ok := <-b.in:
+			if !ok {
+				timer.Stop()
+				flush("close")
+				return
+			}
+			batch = append(batch, item)
+			if len(batch) == 1 {
+				timer.Reset(b.linger)
+				lingerC = timer.C
+			}
+			if len(batch) >= b.size {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				lingerC = nil
+				flush("size")
+			}
+
+		case <-lingerC:
+			lingerC = nil
+			flush("linger")
+		}
+	}
+}
+
+func (b *BatchWriter) flush(ctx context.Context, batch []batchItem, reason string) {
+	log := logger.Get().With("component", "batch_writer")
+
+	events := make([]ProcessedEvent, len(batch))
+	for i, item := range batch {
+		events[i] = item.event
+	}
+
+	failed := b.pipeline.storeAttempt(ctx, events)
+	b.pipeline.metrics.IncBatches()
+
+	for i, item := range batch {
+		ev := item.event
+		if err, ok := failed[i]; ok {
+			retry := &retryItem{event: ev, start: item.start, attempts: 1, err: err}
+			b.pipeline.storeFailed(ctx, retry, log.With("event_id", ev.ID, "type", ev.Type))
+			continue
+		}
+		b.pipeline.recordStored(ev.Event, item.start)
+	}
+
+	log.Debugw("batch flushed",
+		"reason", reason,
+		"size", len(batch),
+		"failed", len(failed),
+	)
+}
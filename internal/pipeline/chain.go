@@ -0,0 +1,194 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrorPolicy says what a ProcessorChain does when a stage fails.
+type ErrorPolicy string
+
+const (
+	// PolicyDeadLetter fails the event and records it as a dead letter.
+	// It is the default.
+	PolicyDeadLetter ErrorPolicy = "dead_letter"
+	// PolicyFail fails the event and discards it.
+	PolicyFail ErrorPolicy = "fail"
+	// PolicySkip ignores the error and passes on the events the stage
+	// returned along with it, or the event unchanged if there are none.
+	PolicySkip ErrorPolicy = "skip"
+)
+
+// ErrEventDropped is returned by ProcessorChain.Process when a stage
+// filtered the event out.
+var ErrEventDropped = errors.New("event dropped by processor")
+
+// Stage is one step of a ProcessorChain. It returns the events that go on
+// down the chain: the event itself (possibly modified), none to drop it,
+// or several to fan it out. A stage that partly failed may return events
+// with its error; they are only used under PolicySkip.
+type Stage interface {
+	Apply(ctx context.Context, ev Event) ([]Event, error)
+}
+
+// StageFunc adapts a function to Stage.
+type StageFunc func(ctx context.Context, ev Event) ([]Event, error)
+
+func (f StageFunc) Apply(ctx context.Context, ev Event) ([]Event, error) {
+	return f(ctx, ev)
+}
+
+// ProcessorStage adapts a Processor to a one-in, one-out Stage.
+func ProcessorStage(p Processor) Stage {
+	return StageFunc(func(ctx context.Context, ev Event) ([]Event, error) {
+		processed, err := p.Process(ctx, ev)
+		if err != nil {
+			return nil, err
+		}
+		return []Event{processed.Event}, nil
+	})
+}
+
+// ChainStage is a named stage of a ProcessorChain and its error policy.
+type ChainStage struct {
+	Name    string
+	Stage   Stage
+	OnError ErrorPolicy
+}
+
+// StageError is returned by a ProcessorChain when a stage whose policy
+// is not skip failed.
+type StageError struct {
+	Stage  string
+	Policy ErrorPolicy
+	Err    error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// ProcessorChain runs events through an ordered list of stages. It is a
+// MultiProcessor, so workers store every event the chain emits. A chain
+// without stages passes events through.
+type ProcessorChain struct {
+	stages  []ChainStage
+	metrics *Metrics
+}
+
+// NewProcessorChain builds a chain of stages, run in order.
+func NewProcessorChain(stages ...ChainStage) *ProcessorChain {
+	c := &ProcessorChain{}
+	for _, s := range stages {
+		c.Append(s)
+	}
+	return c
+}
+
+// Append adds a stage at the end of the chain. It is not safe to call
+// once the chain is processing events.
+func (c *ProcessorChain) Append(s ChainStage) {
+	if s.OnError == "" {
+		s.OnError = PolicyDeadLetter
+	}
+	if s.Name == "" {
+		s.Name = fmt.Sprintf("stage_%d", len(c.stages)+1)
+	}
+	c.stages = append(c.stages, s)
+}
+
+// SetMetrics makes the chain record per-stage timings and outcomes.
+func (c *ProcessorChain) SetMetrics(m *Metrics) {
+	c.metrics = m
+}
+
+// Stages returns the names of the stages, in order.
+func (c *ProcessorChain) Stages() []string {
+	names := make([]string, len(c.stages))
+	for i, s := range c.stages {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// Process implements Processor for chains that emit exactly one event.
+func (c *ProcessorChain) Process(ctx context.Context, ev Event) (*ProcessedEvent, error) {
+	out, err := c.ProcessAll(ctx, ev)
+	if err != nil {
+		return nil, err
+	}
+	switch len(out) {
+	case 0:
+		return nil, ErrEventDropped
+	case 1:
+		return &out[0], nil
+	default:
+		return nil, fmt.Errorf("chain emitted %d events, use ProcessAll", len(out))
+	}
+}
+
+// ProcessAll runs ev through every stage. Each event a stage emits goes
+// through the remaining stages on its own. Emitted events that share an
+// ID get one derived from the input's ID, so a re-run yields the same IDs.
+func (c *ProcessorChain) ProcessAll(ctx context.Context, ev Event) ([]ProcessedEvent, error) {
+	start := time.Now()
+
+	current := []Event{ev}
+	for _, s := range c.stages {
+		var next []Event
+		for _, in := range current {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			stageStart := time.Now()
+			out, err := s.Stage.Apply(ctx, in)
+			outcome := StageOK
+			switch {
+			case err != nil && s.OnError == PolicySkip:
+				outcome = StageSkipped
+				if len(out) == 0 {
+					out = []Event{in}
+				}
+			case err != nil:
+				c.observe(s.Name, time.Since(stageStart), StageErrored)
+				return nil, &StageError{Stage: s.Name, Policy: s.OnError, Err: err}
+			case len(out) == 0:
+				outcome = StageDropped
+			}
+			c.observe(s.Name, time.Since(stageStart), outcome)
+			next = append(next, out...)
+		}
+		current = next
+		if len(current) == 0 {
+			break
+		}
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(start).Milliseconds()
+	seen := make(map[string]bool, len(current))
+	processed := make([]ProcessedEvent, len(current))
+	for i, out := range current {
+		if seen[out.ID] {
+			out.ID = uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%d", ev.ID, i))).String()
+		}
+		seen[out.ID] = true
+		processed[i] = ProcessedEvent{Event: out, ProcessingTimeMS: elapsed, ProcessedAt: now}
+	}
+	return processed, nil
+}
+
+func (c *ProcessorChain) observe(stage string, d time.Duration, outcome StageOutcome) {
+	if c.metrics != nil {
+		c.metrics.ObserveStage(stage, d, outcome)
+	}
+}
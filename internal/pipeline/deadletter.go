@@ -0,0 +1,68 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"event-pipeline/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Failure stages recorded on a DeadLetter.
+const (
+	StageValidation = "validation"
+	StageProcessing = "processing"
+	StageStorage    = "storage"
+)
+
+// DeadLetter is an event the pipeline gave up on, along with why and
+// where it failed.
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Event    Event     `json:"event"`
+	Stage    string    `json:"stage"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+
+	// replay bookkeeping, see Replay
+	ReplayStatus string     `json:"replay_status,omitempty"`
+	ReplayCount  int        `json:"replay_count,omitempty"`
+	ReplayedAt   *time.Time `json:"replayed_at,omitempty"`
+}
+
+// DeadLetterSink records events that failed validation, processing or
+// storage so they can be audited and recovered later.
+type DeadLetterSink interface {
+	Write(ctx context.Context, letters []DeadLetter) error
+}
+
+// deadLetter hands a failed event to the configured sink, if any. Sink
+// errors are logged only; the event has already been counted as failed,
+// but it stays unacked in the WAL so recovery redelivers it.
+func (p *EventPipeline) deadLetter(ctx context.Context, ev Event, stage string, cause error, attempts int) {
+	if p.deadLetters == nil {
+		p.ack(ev)
+		return
+	}
+
+	dl := DeadLetter{
+		ID:       uuid.New().String(),
+		Event:    ev,
+		Stage:    stage,
+		Error:    cause.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now().UTC(),
+	}
+	// shutdown cancels ctx while workers drain, the record must still land
+	if err := p.deadLetters.Write(context.WithoutCancel(ctx), []DeadLetter{dl}); err != nil {
+		logger.Get().Errorw("dead letter write failed",
+			"event_id", ev.ID,
+			"stage", stage,
+			"error", err,
+		)
+		return
+	}
+	p.ack(ev)
+	p.metrics.IncDeadLettered()
+}
@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DedupCache remembers recently seen keys for a fixed TTL, holding at
+// most maxKeys of them. Entries expire in insertion order, so the oldest
+// key is evicted first when the cache is full.
+type DedupCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxKeys int
+	order   *list.List // of *dedupEntry, oldest first
+	keys    map[string]*list.Element
+}
+
+type dedupEntry struct {
+	key     string
+	expires time.Time
+}
+
+func NewDedupCache(ttl time.Duration, maxKeys int) *DedupCache {
+	return &DedupCache{
+		ttl:     ttl,
+		maxKeys: maxKeys,
+		order:   list.New(),
+		keys:    make(map[string]*list.Element),
+	}
+}
+
+// Seen reports whether key was recorded within the TTL, and records it if
+// it was not.
+func (c *DedupCache) Seen(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.evictExpired(now)
+
+	if _, ok := c.keys[key]; ok {
+		return true
+	}
+
+	if c.maxKeys > 0 && c.order.Len() >= c.maxKeys {
+		c.remove(c.order.Front())
+	}
+	c.keys[key] = c.order.PushBack(&dedupEntry{key: key, expires: now.Add(c.ttl)})
+	return false
+}
+
+// Has reports whether key was recorded within the TTL, without recording
+// it.
+func (c *DedupCache) Has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evictExpired(time.Now())
+	_, ok := c.keys[key]
+	return ok
+}
+
+// Forget drops key so the next Seen reports it as new, e.g. when the event
+// it belongs to was not accepted after all.
+func (c *DedupCache) Forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.keys[key]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *DedupCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *DedupCache) evictExpired(now time.Time) {
+	for el := c.order.Front(); el != nil; el = c.order.Front() {
+		if el.Value.(*dedupEntry).expires.After(now) {
+			return
+		}
+		c.remove(el)
+	}
+}
+
+func (c *DedupCache) remove(el *list.Element) {
+	delete(c.keys, el.Value.(*dedupEntry).key)
+	c.order.Remove(el)
+}
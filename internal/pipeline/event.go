@@ -13,6 +13,18 @@ type Event struct {
 	Timestamp time.Time              `json:"timestamp"`
 	UserID    string                 `json:"user_id,omitempty"`
 	Data      map[string]interface{} `json:"data"`
+	// SchemaVersion pins the payload schema the event is validated
+	// against; 0 means the latest registered version.
+	SchemaVersion int `json:"schema_version,omitempty"`
+	// Priority picks the ingestion lane explicitly, see LanesConfig.
+	Priority string `json:"priority,omitempty"`
+
+	// walSeq is the WAL sequence number of an accepted event, 0 if the
+	// pipeline runs without a WAL.
+	walSeq uint64
+	// pending counts the events a fan-out produced from one WAL entry
+	// that have not reached a final outcome yet; nil for a single event.
+	pending *int32
 }
 
 type ProcessedEvent struct {
@@ -0,0 +1,56 @@
+package pipeline
+
+import (
+	"sort"
+	"sync"
+)
+
+// EventTypes is the set of event types the pipeline accepts. Validators
+// reject other types up front and storage checks its schema against it,
+// so an unknown type never reaches the database.
+type EventTypes struct {
+	mu    sync.RWMutex
+	types map[string]struct{}
+}
+
+// NewEventTypes returns a registry holding types.
+func NewEventTypes(types ...string) *EventTypes {
+	t := &EventTypes{}
+	t.Set(types)
+	return t
+}
+
+// Set replaces the allowed types.
+func (t *EventTypes) Set(types []string) {
+	set := make(map[string]struct{}, len(types))
+	for _, name := range types {
+		if name != "" {
+			set[name] = struct{}{}
+		}
+	}
+
+	t.mu.Lock()
+	t.types = set
+	t.mu.Unlock()
+}
+
+// Allowed reports whether name is a known event type.
+func (t *EventTypes) Allowed(name string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, ok := t.types[name]
+	return ok
+}
+
+// List returns the allowed types, sorted.
+func (t *EventTypes) List() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	out := make([]string, 0, len(t.types))
+	for name := range t.types {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -1,11 +1,43 @@
 package pipeline
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCircuitOpen is returned by a Storage that is failing fast instead of
+// trying its backend. Retrying it before the breaker's timeout is pointless.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitOpenError is the ErrCircuitOpen of a named breaker. RetryAfter is
+// how long it stays open before letting trial calls through.
+type CircuitOpenError struct {
+	Name       string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrCircuitOpen, e.Name)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
 
 type Processor interface {
 	Process(ctx context.Context, event Event) (*ProcessedEvent, error)
 }
 
+// MultiProcessor is a Processor that can drop an event or turn it into
+// several. Workers call ProcessAll when the processor implements it; an
+// empty result drops the event.
+type MultiProcessor interface {
+	Processor
+	ProcessAll(ctx context.Context, event Event) ([]ProcessedEvent, error)
+}
+
 type Storage interface {
 	Store(ctx context.Context, events []ProcessedEvent) error
 }
@@ -13,3 +45,15 @@ type Storage interface {
 type Validator interface {
 	Validate(ctx context.Context, event Event) error
 }
+
+// BatchError is returned by a Storage when only some events of a Store
+// call failed. Failed is keyed by the index of the event in the slice
+// passed to Store; events not listed were stored successfully. Any other
+// error returned from Store is treated as a failure of the whole batch.
+type BatchError struct {
+	Failed map[int]error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d event(s) failed to store", len(e.Failed))
+}
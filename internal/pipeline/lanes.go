@@ -0,0 +1,298 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// LanesConfig is the file read by LoadLanesConfig:
+//
+//	{
+//	  "lanes": [
+//	    {"name": "critical", "weight": 8, "types": ["system_log"], "priorities": ["high"]},
+//	    {"name": "default", "weight": 3},
+//	    {"name": "bulk", "weight": 1, "capacity": 5000, "types": ["sensor_data"]}
+//	  ],
+//	  "default": "default"
+//	}
+//
+// An event's explicit priority picks the lane listing it (or named after
+// it); otherwise the first lane matching its type and source wins, and
+// events matching none go to the default lane.
+type LanesConfig struct {
+	Lanes []LaneConfig `json:"lanes"`
+	// Default is the lane for unmatched events, the last lane if empty.
+	Default string `json:"default,omitempty"`
+}
+
+// LaneConfig describes one priority lane. Types and Sources list accepted
+// values; a lane without either only takes explicit priorities and the
+// default.
+type LaneConfig struct {
+	Name string `json:"name"`
+	// Weight is the lane's share of the workers while several lanes are
+	// backlogged, at least 1.
+	Weight int `json:"weight,omitempty"`
+	// Capacity bounds the lane's queue, QUEUE_SIZE if 0.
+	Capacity   int      `json:"capacity,omitempty"`
+	Types      []string `json:"types,omitempty"`
+	Sources    []string `json:"sources,omitempty"`
+	Priorities []string `json:"priorities,omitempty"`
+}
+
+// LaneStats is the state of one priority lane.
+type LaneStats struct {
+	Depth    int    `json:"depth"`
+	Capacity int    `json:"capacity"`
+	Weight   int    `json:"weight"`
+	Dequeued uint64 `json:"dequeued"`
+}
+
+// LoadLanesConfig reads and checks a lanes config from path.
+func LoadLanesConfig(path string) (*LanesConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lanes: %w", err)
+	}
+	var cfg LanesConfig
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid lanes: %w", err)
+	}
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (cfg *LanesConfig) check() error {
+	if len(cfg.Lanes) == 0 {
+		return fmt.Errorf("invalid lanes: no lanes")
+	}
+	seen := make(map[string]bool, len(cfg.Lanes))
+	for i, lc := range cfg.Lanes {
+		if lc.Name == "" {
+			return fmt.Errorf("lane %d: no name", i)
+		}
+		if seen[lc.Name] {
+			return fmt.Errorf("lane %d: duplicate name %q", i, lc.Name)
+		}
+		if lc.Weight < 0 || lc.Capacity < 0 {
+			return fmt.Errorf("lane %s: weight and capacity must not be negative", lc.Name)
+		}
+		seen[lc.Name] = true
+	}
+	if cfg.Default != "" && !seen[cfg.Default] {
+		return fmt.Errorf("default lane: unknown lane %q", cfg.Default)
+	}
+	return nil
+}
+
+// lane is one queue of the ingestion lanes.
+type lane struct {
+	LaneConfig
+	queue chan Event
+	// credit is the smooth weighted round robin state.
+	credit   int
+	dequeued uint64
+}
+
+func (ln *lane) matches(ev Event) bool {
+	if len(ln.Types) == 0 && len(ln.Sources) == 0 {
+		return false
+	}
+	if len(ln.Types) > 0 && !containsString(ln.Types, ev.Type) {
+		return false
+	}
+	if len(ln.Sources) > 0 && !containsString(ln.Sources, ev.Source) {
+		return false
+	}
+	return true
+}
+
+// Lanes splits the ingestion queue into priority lanes. Ingest puts each
+// event in its lane, and a dispatcher hands the workers the next event
+// from the backlogged lanes by smooth weighted round robin, so a flood in
+// one lane only takes its weighted share of the workers while the others
+// keep moving.
+type Lanes struct {
+	pipeline *EventPipeline
+	lanes    []*lane
+	def      *lane
+	// out feeds the workers; it is unbuffered so priorities apply at the
+	// moment a worker becomes free.
+	out    chan Event
+	wake   chan struct{}
+	done   chan struct{}
+	closed int32
+}
+
+func newLanes(p *EventPipeline, cfg LanesConfig, queueSize int) *Lanes {
+	l := &Lanes{
+		pipeline: p,
+		out:      make(chan Event),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	for _, lc := range cfg.Lanes {
+		if lc.Weight < 1 {
+			lc.Weight = 1
+		}
+		if lc.Capacity <= 0 {
+			lc.Capacity = queueSize
+		}
+		ln := &lane{LaneConfig: lc, queue: make(chan Event, lc.Capacity)}
+		l.lanes = append(l.lanes, ln)
+		if lc.Name == cfg.Default {
+			l.def = ln
+		}
+	}
+	if l.def == nil {
+		l.def = l.lanes[len(l.lanes)-1]
+	}
+	return l
+}
+
+func (l *Lanes) Start(ctx context.Context) {
+	go l.run(ctx)
+}
+
+// route returns the lane for ev.
+func (l *Lanes) route(ev Event) *lane {
+	if ev.Priority != "" {
+		for _, ln := range l.lanes {
+			if ln.Name == ev.Priority || containsString(ln.Priorities, ev.Priority) {
+				return ln
+			}
+		}
+	}
+	for _, ln := range l.lanes {
+		if ln.matches(ev) {
+			return ln
+		}
+	}
+	return l.def
+}
+
+// queued tells the dispatcher an event was put in a lane.
+func (l *Lanes) queued() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close tells the dispatcher no more events will be queued. It closes the
+// workers' channel once every lane is empty. Callers must make sure no
+// send to a lane is in progress.
+func (l *Lanes) Close() {
+	atomic.StoreInt32(&l.closed, 1)
+	l.queued()
+}
+
+// Len is the number of events waiting in all lanes.
+func (l *Lanes) Len() int {
+	n := 0
+	for _, ln := range l.lanes {
+		n += len(ln.queue)
+	}
+	return n
+}
+
+// Stats reports the depth and counters of every lane.
+func (l *Lanes) Stats() map[string]LaneStats {
+	out := make(map[string]LaneStats, len(l.lanes))
+	for _, ln := range l.lanes {
+		out[ln.Name] = LaneStats{
+			Depth:    len(ln.queue),
+			Capacity: ln.Capacity,
+			Weight:   ln.Weight,
+			Dequeued: atomic.LoadUint64(&ln.dequeued),
+		}
+	}
+	return out
+}
+
+// drain removes and returns the events left in the lanes once the
+// dispatcher has stopped.
+func (l *Lanes) drain() []Event {
+	var events []Event
+	for _, ln := range l.lanes {
+		for len(ln.queue) > 0 {
+			events = append(events, <-ln.queue)
+		}
+	}
+	return events
+}
+
+// next picks the lane to serve by smooth weighted round robin over the
+// lanes that have events, nil if all are empty. Idle lanes do not bank
+// credit.
+func (l *Lanes) next() *lane {
+	var best *lane
+	total := 0
+	for _, ln := range l.lanes {
+		if len(ln.queue) == 0 {
+			ln.credit = 0
+			continue
+		}
+		ln.credit += ln.Weight
+		total += ln.Weight
+		if best == nil || ln.credit > best.credit {
+			best = ln
+		}
+	}
+	if best != nil {
+		best.credit -= total
+	}
+	return best
+}
+
+func (l *Lanes) run(ctx context.Context) {
+	defer close(l.done)
+	// workers exit on a closed channel, as without lanes
+	defer close(l.out)
+
+	for {
+		ln := l.next()
+		if ln == nil {
+			if atomic.LoadInt32(&l.closed) == 1 {
+				if l.Len() == 0 {
+					return
+				}
+				// an event queued just before Close was missed
+				continue
+			}
+			select {
+			case <-l.wake:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		// the dispatcher is the only receiver, a non-empty lane cannot block
+		ev := <-ln.queue
+		atomic.AddUint64(&ln.dequeued, 1)
+		select {
+		case l.out <- ev:
+		case <-ctx.Done():
+			l.pipeline.spill(ev, errShutdownAborted)
+			return
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
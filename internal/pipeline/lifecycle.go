@@ -0,0 +1,47 @@
+package pipeline
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrPipelineClosed is returned by Ingest once Shutdown has started.
+var ErrPipelineClosed = errors.New("pipeline closed")
+
+// State is the lifecycle stage of an EventPipeline. It only moves forward:
+// starting → running → draining → stopped.
+type State int32
+
+const (
+	StateStarting State = iota
+	StateRunning
+	StateDraining
+	StateStopped
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateDraining:
+		return "draining"
+	case StateStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+type stateValue struct {
+	v int32
+}
+
+func (s *stateValue) Load() State {
+	return State(atomic.LoadInt32(&s.v))
+}
+
+func (s *stateValue) Store(st State) {
+	atomic.StoreInt32(&s.v, int32(st))
+}
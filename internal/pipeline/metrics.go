@@ -1,17 +1,87 @@
 package pipeline
 
 import (
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// StageOutcome is the result of one ProcessorChain stage run.
+type StageOutcome int
+
+const (
+	StageOK StageOutcome = iota
+	StageDropped
+	StageSkipped
+	StageErrored
+)
+
+// StageStats summarises the runs of one processor stage.
+type StageStats struct {
+	Calls        uint64  `json:"calls"`
+	Dropped      uint64  `json:"dropped"`
+	Skipped      uint64  `json:"skipped"`
+	Errors       uint64  `json:"errors"`
+	AvgLatencyMS float64 `json:"avg_latency_ms"`
+}
+
+// LookupStats summarises the lookups against one enrichment table.
+type LookupStats struct {
+	Lookups     uint64  `json:"lookups"`
+	CacheHits   uint64  `json:"cache_hits"`
+	MissingKeys uint64  `json:"missing_keys"`
+	Errors      uint64  `json:"errors"`
+	HitRate     float64 `json:"cache_hit_rate"`
+}
+
+// SinkStats summarises the deliveries to one storage sink.
+type SinkStats struct {
+	Stored  uint64 `json:"stored"`
+	Failed  uint64 `json:"failed"`
+	Retries uint64 `json:"retries"`
+}
+
+// BreakerStats is the state of one storage circuit breaker.
+type BreakerStats struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	Trips               uint64 `json:"trips"`
+	Rejected            uint64 `json:"rejected"`
+	Fallback            uint64 `json:"fallback_events"`
+}
+
 type Metrics struct {
-	received  uint64
-	processed uint64
-	failed    uint64
+	received     uint64
+	processed    uint64
+	failed       uint64
+	batches      uint64
+	deadLettered uint64
+	rejected     uint64
+	spilled      uint64
+	recovered    uint64
+	duplicates   uint64
+	filtered     uint64
+	retries      uint64
 
 	totalLatencyMS uint64
 	startTime      time.Time
+
+	stagesMu sync.Mutex
+	stages   map[string]*stageCounters
+
+	lookupsMu sync.Mutex
+	lookups   map[string]*LookupStats
+
+	sinksMu sync.Mutex
+	sinks   map[string]*SinkStats
+
+	breakersMu sync.Mutex
+	breakers   map[string]BreakerStats
+}
+
+type stageCounters struct {
+	StageStats
+	total time.Duration
 }
 
 func NewMetrics() *Metrics {
@@ -30,6 +100,131 @@ func (m *Metrics) IncFailed() {
 	atomic.AddUint64(&m.failed, 1)
 }
 
+func (m *Metrics) IncBatches() {
+	atomic.AddUint64(&m.batches, 1)
+}
+
+func (m *Metrics) IncDeadLettered() {
+	atomic.AddUint64(&m.deadLettered, 1)
+}
+
+func (m *Metrics) IncRejected() {
+	atomic.AddUint64(&m.rejected, 1)
+}
+
+func (m *Metrics) IncSpilled() {
+	atomic.AddUint64(&m.spilled, 1)
+}
+
+func (m *Metrics) AddRecovered(n uint64) {
+	atomic.AddUint64(&m.recovered, n)
+}
+
+func (m *Metrics) IncDuplicates() {
+	atomic.AddUint64(&m.duplicates, 1)
+}
+
+func (m *Metrics) IncRetries() {
+	atomic.AddUint64(&m.retries, 1)
+}
+
+func (m *Metrics) IncFiltered() {
+	atomic.AddUint64(&m.filtered, 1)
+}
+
+// ObserveStage records one run of a processor stage.
+func (m *Metrics) ObserveStage(stage string, d time.Duration, outcome StageOutcome) {
+	m.stagesMu.Lock()
+	defer m.stagesMu.Unlock()
+
+	if m.stages == nil {
+		m.stages = make(map[string]*stageCounters)
+	}
+	c, ok := m.stages[stage]
+	if !ok {
+		c = &stageCounters{}
+		m.stages[stage] = c
+	}
+	c.Calls++
+	c.total += d
+	switch outcome {
+	case StageDropped:
+		c.Dropped++
+	case StageSkipped:
+		c.Skipped++
+	case StageErrored:
+		c.Errors++
+	}
+}
+
+// ObserveLookup records one lookup against an enrichment table: whether
+// it was answered from the cache, and whether the key was found.
+func (m *Metrics) ObserveLookup(table string, cacheHit, found bool) {
+	m.lookupsMu.Lock()
+	defer m.lookupsMu.Unlock()
+
+	st := m.lookupStats(table)
+	st.Lookups++
+	if cacheHit {
+		st.CacheHits++
+	}
+	if !found {
+		st.MissingKeys++
+	}
+}
+
+// ObserveLookupError records a lookup that failed.
+func (m *Metrics) ObserveLookupError(table string) {
+	m.lookupsMu.Lock()
+	defer m.lookupsMu.Unlock()
+
+	st := m.lookupStats(table)
+	st.Lookups++
+	st.Errors++
+}
+
+func (m *Metrics) lookupStats(table string) *LookupStats {
+	if m.lookups == nil {
+		m.lookups = make(map[string]*LookupStats)
+	}
+	st, ok := m.lookups[table]
+	if !ok {
+		st = &LookupStats{}
+		m.lookups[table] = st
+	}
+	return st
+}
+
+// ObserveSink records the outcome of one delivery to a storage sink:
+// events stored, events that failed for good, and retry attempts.
+func (m *Metrics) ObserveSink(sink string, stored, failed, retries int) {
+	m.sinksMu.Lock()
+	defer m.sinksMu.Unlock()
+
+	if m.sinks == nil {
+		m.sinks = make(map[string]*SinkStats)
+	}
+	st, ok := m.sinks[sink]
+	if !ok {
+		st = &SinkStats{}
+		m.sinks[sink] = st
+	}
+	st.Stored += uint64(stored)
+	st.Failed += uint64(failed)
+	st.Retries += uint64(retries)
+}
+
+// ObserveBreaker records the latest state of a circuit breaker.
+func (m *Metrics) ObserveBreaker(name string, st BreakerStats) {
+	m.breakersMu.Lock()
+	defer m.breakersMu.Unlock()
+
+	if m.breakers == nil {
+		m.breakers = make(map[string]BreakerStats)
+	}
+	m.breakers[name] = st
+}
+
 func (m *Metrics) AddLatency(ms int64) {
 	atomic.AddUint64(&m.totalLatencyMS, uint64(ms))
 }
@@ -46,6 +241,100 @@ func (m *Metrics) GetFailed() uint64 {
 	return atomic.LoadUint64(&m.failed)
 }
 
+func (m *Metrics) GetBatches() uint64 {
+	return atomic.LoadUint64(&m.batches)
+}
+
+func (m *Metrics) GetDeadLettered() uint64 {
+	return atomic.LoadUint64(&m.deadLettered)
+}
+
+func (m *Metrics) GetRejected() uint64 {
+	return atomic.LoadUint64(&m.rejected)
+}
+
+func (m *Metrics) GetSpilled() uint64 {
+	return atomic.LoadUint64(&m.spilled)
+}
+
+func (m *Metrics) GetRecovered() uint64 {
+	return atomic.LoadUint64(&m.recovered)
+}
+
+func (m *Metrics) GetDuplicates() uint64 {
+	return atomic.LoadUint64(&m.duplicates)
+}
+
+func (m *Metrics) GetRetries() uint64 {
+	return atomic.LoadUint64(&m.retries)
+}
+
+func (m *Metrics) GetFiltered() uint64 {
+	return atomic.LoadUint64(&m.filtered)
+}
+
+// StageStats returns a snapshot of the per-stage counters.
+func (m *Metrics) StageStats() map[string]StageStats {
+	m.stagesMu.Lock()
+	defer m.stagesMu.Unlock()
+
+	out := make(map[string]StageStats, len(m.stages))
+	for name, c := range m.stages {
+		st := c.StageStats
+		if c.Calls > 0 {
+			st.AvgLatencyMS = float64(c.total.Microseconds()) / float64(c.Calls) / 1000
+		}
+		out[name] = st
+	}
+	return out
+}
+
+// LookupStats returns a snapshot of the per-table enrichment counters.
+func (m *Metrics) LookupStats() map[string]LookupStats {
+	m.lookupsMu.Lock()
+	defer m.lookupsMu.Unlock()
+
+	out := make(map[string]LookupStats, len(m.lookups))
+	for table, st := range m.lookups {
+		snap := *st
+		if snap.Lookups > 0 {
+			snap.HitRate = float64(snap.CacheHits) / float64(snap.Lookups)
+		}
+		out[table] = snap
+	}
+	return out
+}
+
+// SinkStats returns a snapshot of the per-sink storage counters.
+func (m *Metrics) SinkStats() map[string]SinkStats {
+	m.sinksMu.Lock()
+	defer m.sinksMu.Unlock()
+
+	out := make(map[string]SinkStats, len(m.sinks))
+	for sink, st := range m.sinks {
+		out[sink] = *st
+	}
+	return out
+}
+
+// BreakerStats returns the state of every circuit breaker.
+func (m *Metrics) BreakerStats() map[string]BreakerStats {
+	m.breakersMu.Lock()
+	defer m.breakersMu.Unlock()
+
+	out := make(map[string]BreakerStats, len(m.breakers))
+	for name, st := range m.breakers {
+		out[name] = st
+	}
+	return out
+}
+
+// GetTotalLatencyMS is the summed latency of all processed events; the
+// autoscaler diffs it to get the latency of recent events.
+func (m *Metrics) GetTotalLatencyMS() uint64 {
+	return atomic.LoadUint64(&m.totalLatencyMS)
+}
+
 func (m *Metrics) AvgLatencyMS() float64 {
 	processed := atomic.LoadUint64(&m.processed)
 	if processed == 0 {
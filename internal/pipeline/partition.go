@@ -0,0 +1,99 @@
+package pipeline
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync/atomic"
+)
+
+// Partitioner gives every worker its own queue and sends all events with
+// the same key to the same one, so they are processed in the order they
+// were accepted. Events without a key have no order to keep and are spread
+// round robin.
+type Partitioner struct {
+	key    string
+	queues []chan Event
+	next   uint32
+}
+
+// newPartitioner splits queueSize between n worker queues. key is
+// user_id, source, type, or a dotted Data field with or without the
+// "data." prefix.
+func newPartitioner(key string, n, queueSize int) *Partitioner {
+	size := (queueSize + n - 1) / n
+	if size < 1 {
+		size = 1
+	}
+	p := &Partitioner{key: key, queues: make([]chan Event, n)}
+	for i := range p.queues {
+		p.queues[i] = make(chan Event, size)
+	}
+	return p
+}
+
+// Key returns the partition key of ev, false if ev has none.
+func (p *Partitioner) Key(ev Event) (string, bool) {
+	var v interface{}
+	switch p.key {
+	case "user_id":
+		v = ev.UserID
+	case "source":
+		v = ev.Source
+	case "type":
+		v = ev.Type
+	default:
+		var cur interface{} = ev.Data
+		for _, part := range strings.Split(strings.TrimPrefix(p.key, "data."), ".") {
+			obj, ok := cur.(map[string]interface{})
+			if !ok {
+				return "", false
+			}
+			if cur, ok = obj[part]; !ok {
+				return "", false
+			}
+		}
+		v = cur
+	}
+	if v == nil || v == "" {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// route returns the queue of ev's partition.
+func (p *Partitioner) route(ev Event) chan Event {
+	key, ok := p.Key(ev)
+	if !ok {
+		return p.queues[int(atomic.AddUint32(&p.next, 1)-1)%len(p.queues)]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return p.queues[int(h.Sum32()%uint32(len(p.queues)))]
+}
+
+// close closes every queue; workers exit once theirs is drained.
+func (p *Partitioner) close() {
+	for _, q := range p.queues {
+		close(q)
+	}
+}
+
+// Len is the number of events waiting in all partitions.
+func (p *Partitioner) Len() int {
+	n := 0
+	for _, q := range p.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// Depths reports the number of waiting events per partition, to spot hot
+// keys.
+func (p *Partitioner) Depths() []int {
+	depths := make([]int, len(p.queues))
+	for i, q := range p.queues {
+		depths[i] = len(q)
+	}
+	return depths
+}
@@ -2,29 +2,118 @@ package pipeline
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"event-pipeline/internal/config"
 	"event-pipeline/pkg/logger"
 )
 
+// ErrQueueFull is returned by Ingest when the ingestion queue stayed full
+// for the whole enqueue timeout.
+var ErrQueueFull = errors.New("ingestion queue full")
+
+// ErrDuplicate is returned by Ingest for an event whose ID was already
+// accepted within the dedup TTL. The event is dropped; callers should
+// treat it as accepted.
+var ErrDuplicate = errors.New("duplicate event")
+
 type EventPipeline struct {
 	ingestionChan chan Event
 	workerPool    []*Worker
+	batcher       *BatchWriter
+	lanes         *Lanes
+	lanesCfg      *LanesConfig
+	partitions    *Partitioner
 	storage       Storage
 	processor     Processor
 	validator     Validator
+	deadLetters   DeadLetterSink
 	metrics       *Metrics
 	cfg           *config.Config
 	ctx           context.Context
 	cancel        context.CancelFunc
+	spillSink     DeadLetterSink
+	wal           *WAL
+	dedup         *DedupCache
+	retry         *RetryPolicy
+	retries       *RetryQueue
 	startTime     time.Time
 	wg            sync.WaitGroup
+	// drained is done once every worker saw the ingestion queue close.
+	drained sync.WaitGroup
+
+	state stateValue
+	// ingestMu guards sends on ingestionChan against Shutdown closing it:
+	// Ingest holds the read lock, Shutdown the write lock.
+	ingestMu sync.RWMutex
+	stopOnce sync.Once
+	stopped  chan struct{}
+
+	// workersMu guards workerPool and lastWorkerID while the pool is
+	// resized at runtime.
+	workersMu    sync.Mutex
+	lastWorkerID int
+
+	// workCtx is handed to workers and storage; it is only cancelled when
+	// a Shutdown deadline expires, to abort retries and in-flight stores.
+	workCtx   context.Context
+	abortWork context.CancelFunc
+	summary   ShutdownSummary
+	stopErr   error
+	spilled   uint64
+	dropped   uint64
+}
+
+// Option configures optional pipeline components.
+type Option func(*EventPipeline)
+
+// WithSpillSink sets where Shutdown writes events it could not drain
+// before its deadline. Without it they go to the dead letter sink.
+func WithSpillSink(sink DeadLetterSink) Option {
+	return func(p *EventPipeline) {
+		p.spillSink = sink
+	}
+}
+
+// WithWAL makes Ingest append every event to wal before accepting it,
+// and re-enqueues the events wal recovered as unacked on startup.
+func WithWAL(wal *WAL) Option {
+	return func(p *EventPipeline) {
+		p.wal = wal
+	}
+}
+
+// WithLanes splits the ingestion queue into the priority lanes of cfg.
+func WithLanes(cfg *LanesConfig) Option {
+	return func(p *EventPipeline) {
+		p.lanesCfg = cfg
+	}
+}
+
+// WithRetryPolicy replaces the storage retry policy built from the
+// MaxRetries, RetryBaseBackoff and RetryMaxBackoff settings, e.g. to plug
+// in another error classification.
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(p *EventPipeline) {
+		p.retry = policy
+	}
+}
+
+// WithDeadLetterSink records events that fail validation, processing or
+// storage in sink instead of dropping them.
+func WithDeadLetterSink(sink DeadLetterSink) Option {
+	return func(p *EventPipeline) {
+		p.deadLetters = sink
+	}
 }
 
-func NewEventPipeline(store Storage, proc Processor, val Validator, metrics *Metrics, cfg *config.Config) *EventPipeline {
+func NewEventPipeline(store Storage, proc Processor, val Validator, metrics *Metrics, cfg *config.Config, opts ...Option) *EventPipeline {
 	ctx, cancel := context.WithCancel(context.Background())
+	workCtx, abortWork := context.WithCancel(context.Background())
 	p := &EventPipeline{
 		ingestionChan: make(chan Event, cfg.QueueSize),
 		storage:       store,
@@ -35,55 +124,236 @@ func NewEventPipeline(store Storage, proc Processor, val Validator, metrics *Met
 		ctx:           ctx,
 		cancel:        cancel,
 		startTime:     time.Now(),
+		stopped:       make(chan struct{}),
+		workCtx:       workCtx,
+		abortWork:     abortWork,
+		retries:       newRetryQueue(),
+	}
+	p.state.Store(StateStarting)
+	p.retry = NewRetryPolicy(cfg.MaxRetries, cfg.RetryBaseBackoff, cfg.RetryMaxBackoff)
+	for _, opt := range opts {
+		opt(p)
+	}
+	if cfg.DedupTTL > 0 {
+		p.dedup = NewDedupCache(cfg.DedupTTL, cfg.DedupMaxKeys)
 	}
 
 	log := logger.Get()
+	switch {
+	case cfg.PartitionKey != "" && cfg.WorkerCount > 0:
+		// every worker reads its own partition, in order
+		p.partitions = newPartitioner(cfg.PartitionKey, cfg.WorkerCount, cfg.QueueSize)
+		if p.lanesCfg != nil {
+			log.Warnw("priority lanes are ignored in partitioned mode", "partition_key", cfg.PartitionKey)
+		}
+		if cfg.BatchSize > 1 {
+			log.Warnw("batching is disabled in partitioned mode", "partition_key", cfg.PartitionKey, "batch_size", cfg.BatchSize)
+		}
+	case p.lanesCfg != nil && len(p.lanesCfg.Lanes) > 0:
+		// the workers read what the dispatcher picks from the lanes
+		p.lanes = newLanes(p, *p.lanesCfg, cfg.QueueSize)
+		p.ingestionChan = p.lanes.out
+	}
+
 	log.Infow("starting pipeline",
 		"workers", cfg.WorkerCount,
 		"queue_size", cfg.QueueSize,
+		"enqueue_timeout_ms", cfg.EnqueueTimeout.Milliseconds(),
 		"max_retries", cfg.MaxRetries,
 		"retry_backoff_ms", cfg.RetryBaseBackoff.Milliseconds(),
+		"retry_max_backoff_ms", cfg.RetryMaxBackoff.Milliseconds(),
+		"batch_size", cfg.BatchSize,
+		"batch_linger_ms", cfg.BatchLinger.Milliseconds(),
+		"dead_letters", p.deadLetters != nil,
+		"spill_sink", p.spillSink != nil,
+		"wal", p.wal != nil,
+		"dedup_ttl_ms", cfg.DedupTTL.Milliseconds(),
+		"lanes", p.laneNames(),
+		"partition_key", cfg.PartitionKey,
 	)
 
+	// batching is opt-in: a batch size of 0 or 1 keeps the per-event
+	// Store call inside the worker. A shared batch would mix partitions and
+	// reorder a key's retries, so partitioned workers always store their
+	// own events.
+	if cfg.BatchSize > 1 && p.partitions == nil {
+		p.batcher = newBatchWriter(p, cfg.BatchSize, cfg.BatchLinger)
+		p.batcher.Start(workCtx)
+	}
+	p.retries.Start(workCtx)
+	if p.lanes != nil {
+		p.lanes.Start(workCtx)
+	}
+
+	p.workersMu.Lock()
 	for i := 0; i < cfg.WorkerCount; i++ {
-		w := &Worker{
-			id:       i + 1,
-			jobChan:  p.ingestionChan,
-			pipeline: p,
-			wg:       &p.wg,
+		jobs := p.ingestionChan
+		if p.partitions != nil {
+			jobs = p.partitions.queues[i]
 		}
-		p.workerPool = append(p.workerPool, w)
-		w.Start(ctx)
-		log.Infow("worker started", "worker_id", w.id)
+		p.startWorker(jobs)
+	}
+	p.workersMu.Unlock()
+
+	if p.wal != nil {
+		p.recoverWAL()
 	}
 
+	p.state.Store(StateRunning)
 	log.Infow("pipeline started", "worker_count", cfg.WorkerCount)
 	return p
 }
 
-func (p *EventPipeline) Ingest(ev Event) {
-	p.ingestionChan <- NewEvent(ev)
+// Ingest queues an event for processing. When the queue is full it waits
+// up to EnqueueTimeout for room (or not at all if the timeout is zero) and
+// then gives up with ErrQueueFull, so callers can tell producers to back off.
+// Once Shutdown has started it returns ErrPipelineClosed, and for an ID
+// accepted within the dedup TTL it returns ErrDuplicate.
+func (p *EventPipeline) Ingest(ev Event) error {
+	return p.ingest(ev, true)
+}
+
+// IngestNew is Ingest for an event whose ID the caller just generated. Such
+// an ID cannot repeat, so it skips the duplicate check and never takes a
+// slot in the dedup cache.
+func (p *EventPipeline) IngestNew(ev Event) error {
+	return p.ingest(ev, false)
+}
+
+func (p *EventPipeline) ingest(ev Event, dedup bool) error {
+	// only client supplied IDs can repeat
+	dedup = dedup && p.dedup != nil && ev.ID != ""
+	ev = NewEvent(ev)
+
+	p.ingestMu.RLock()
+	defer p.ingestMu.RUnlock()
+	if p.state.Load() != StateRunning {
+		return ErrPipelineClosed
+	}
+
+	if dedup && p.dedup.Seen(ev.ID) {
+		p.metrics.IncDuplicates()
+		logger.Get().Infow("duplicate event dropped",
+			"event_id", ev.ID,
+			"type", ev.Type,
+			"source", ev.Source,
+		)
+		return ErrDuplicate
+	}
+
+	if err := p.enqueue(ev); err != nil {
+		if dedup {
+			// the producer retries a rejected event with the same ID
+			p.dedup.Forget(ev.ID)
+		}
+		return err
+	}
+
 	logger.Get().Debugw("event ingested",
 		"event_id", ev.ID,
 		"type", ev.Type,
 		"source", ev.Source,
 	)
+	return nil
 }
 
-func (p *EventPipeline) Shutdown() {
-    log := logger.Get()
-    log.Info("initiating graceful shutdown")
+// enqueue makes ev durable in the WAL, if any, and queues it.
+func (p *EventPipeline) enqueue(ev Event) error {
+	if p.wal != nil {
+		seq, err := p.wal.Append(ev)
+		if err != nil {
+			logger.Get().Errorw("wal append failed", "event_id", ev.ID, "error", err)
+			return fmt.Errorf("wal append failed: %w", err)
+		}
+		ev.walSeq = seq
+	}
 
-    // close channel → lets workers finish draining
-    close(p.ingestionChan)
+	queue := p.queueFor(ev)
+	select {
+	case queue <- ev:
+	default:
+		if err := p.enqueueWait(queue, ev); err != nil {
+			// not accepted, the producer is told to retry
+			p.ack(ev)
+			p.metrics.IncRejected()
+			logger.Get().Warnw("event rejected",
+				"event_id", ev.ID,
+				"type", ev.Type,
+				"source", ev.Source,
+				"error", err,
+			)
+			return err
+		}
+	}
+	if p.lanes != nil {
+		p.lanes.queued()
+	}
+	return nil
+}
 
-    // cancel context → in case workers are blocked in select
-    p.cancel()
+// queueFor is the channel ev is queued on: its partition or lane, or the
+// single ingestion queue.
+func (p *EventPipeline) queueFor(ev Event) chan Event {
+	switch {
+	case p.partitions != nil:
+		return p.partitions.route(ev)
+	case p.lanes != nil:
+		return p.lanes.route(ev).queue
+	}
+	return p.ingestionChan
+}
+
+func (p *EventPipeline) enqueueWait(queue chan Event, ev Event) error {
+	if p.cfg.EnqueueTimeout <= 0 {
+		return ErrQueueFull
+	}
+
+	timer := time.NewTimer(p.cfg.EnqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case queue <- ev:
+		return nil
+	case <-timer.C:
+		return ErrQueueFull
+	}
+}
+
+// recoverWAL re-enqueues events a previous run accepted but never finished.
+// It runs before the pipeline reports running and blocks until the whole
+// backlog is queued.
+func (p *EventPipeline) recoverWAL() {
+	pending := p.wal.Pending()
+	if len(pending) == 0 {
+		return
+	}
+
+	logger.Get().Infow("recovering events from wal", "count", len(pending))
+	for _, ev := range pending {
+		p.queueFor(ev) <- ev
+		if p.lanes != nil {
+			p.lanes.queued()
+		}
+	}
+	p.metrics.AddRecovered(uint64(len(pending)))
+}
 
-    // wait for workers
-    p.wg.Wait()
+// ack checkpoints an event in the WAL once it reached a final outcome.
+func (p *EventPipeline) ack(ev Event) {
+	if p.wal == nil || ev.walSeq == 0 {
+		return
+	}
+	// a fanned-out event is done once all its outputs are
+	if ev.pending != nil && atomic.AddInt32(ev.pending, -1) > 0 {
+		return
+	}
+	if err := p.wal.Ack(ev.walSeq); err != nil {
+		logger.Get().Warnw("wal ack failed", "event_id", ev.ID, "error", err)
+	}
+}
 
-    log.Info("all workers stopped, shutdown complete")
+func (p *EventPipeline) State() State {
+	return p.state.Load()
 }
 
 func (p *EventPipeline) Metrics() *Metrics {
@@ -94,7 +364,55 @@ func (p *EventPipeline) Queue() chan Event {
 	return p.ingestionChan
 }
 
+// QueueDepth is the number of events waiting for a worker, across all
+// lanes or partitions.
+func (p *EventPipeline) QueueDepth() int {
+	switch {
+	case p.partitions != nil:
+		return p.partitions.Len()
+	case p.lanes != nil:
+		return p.lanes.Len()
+	}
+	return len(p.ingestionChan)
+}
+
+// PartitionDepths reports the queue depth of every worker partition, none
+// in the shared-queue mode.
+func (p *EventPipeline) PartitionDepths() []int {
+	if p.partitions == nil {
+		return []int{}
+	}
+	return p.partitions.Depths()
+}
+
+// LaneStats reports every priority lane, none without lanes.
+func (p *EventPipeline) LaneStats() map[string]LaneStats {
+	if p.lanes == nil {
+		return map[string]LaneStats{}
+	}
+	return p.lanes.Stats()
+}
+
+func (p *EventPipeline) laneNames() []string {
+	if p.lanes == nil {
+		return nil
+	}
+	names := make([]string, len(p.lanes.lanes))
+	for i, ln := range p.lanes.lanes {
+		names[i] = ln.Name
+	}
+	return names
+}
+
+// RetryQueueDepth is the number of events waiting for another storage
+// attempt.
+func (p *EventPipeline) RetryQueueDepth() int {
+	return p.retries.Len()
+}
+
 func (p *EventPipeline) WorkerCount() int {
+	p.workersMu.Lock()
+	defer p.workersMu.Unlock()
 	return len(p.workerPool)
 }
 
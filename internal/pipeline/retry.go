@@ -0,0 +1,185 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// ErrorClass tells a RetryPolicy whether an error is worth retrying.
+type ErrorClass int
+
+const (
+	// ErrorRetryable errors may go away on their own: a lost connection,
+	// a deadlock, a full connection pool.
+	ErrorRetryable ErrorClass = iota
+	// ErrorPermanent errors fail the same way on every attempt: bad data,
+	// an unknown event type, a missing table.
+	ErrorPermanent
+)
+
+func (c ErrorClass) String() string {
+	if c == ErrorPermanent {
+		return "permanent"
+	}
+	return "retryable"
+}
+
+// PermanentError marks an error as not worth retrying.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks err as not worth retrying. A nil err stays nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err, or an error it wraps, was marked with
+// Permanent.
+func IsPermanent(err error) bool {
+	var perm *PermanentError
+	return errors.As(err, &perm)
+}
+
+// ClassifyError is the default classification: errors marked Permanent
+// and a cancelled context are not retried, anything else is. An open
+// circuit breaker is retried once it lets trial calls through, see
+// retryAfter.
+func ClassifyError(err error) ErrorClass {
+	switch {
+	case IsPermanent(err),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return ErrorPermanent
+	}
+	return ErrorRetryable
+}
+
+// retryAfter is the least wait err asks for before another attempt, 0 if
+// it does not say: an open circuit breaker's remaining timeout.
+func retryAfter(err error) time.Duration {
+	var open *CircuitOpenError
+	if errors.As(err, &open) {
+		return open.RetryAfter
+	}
+	return 0
+}
+
+// RetryPolicy decides how often and how long to wait before retrying a
+// failed call. Waits grow exponentially from BaseBackoff, are capped at
+// MaxBackoff, and use full jitter: a random wait between zero and the cap,
+// so workers that failed together do not retry together.
+type RetryPolicy struct {
+	// MaxAttempts counts the first try; values below 1 mean one attempt.
+	MaxAttempts int
+	BaseBackoff time.Duration
+	// MaxBackoff caps a single wait; 0 means no cap.
+	MaxBackoff time.Duration
+	// Classify is the error classification hook, ClassifyError if nil.
+	Classify func(error) ErrorClass
+}
+
+// NewRetryPolicy returns a policy with the default classification.
+func NewRetryPolicy(maxAttempts int, base, max time.Duration) *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: maxAttempts, BaseBackoff: base, MaxBackoff: max}
+}
+
+// Attempts is the number of tries the policy allows, at least 1.
+func (p *RetryPolicy) Attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// Retryable reports whether err is worth another attempt.
+func (p *RetryPolicy) Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	classify := p.Classify
+	if classify == nil {
+		classify = ClassifyError
+	}
+	return classify(err) == ErrorRetryable
+}
+
+// Backoff is the wait after the given failed attempt, counting from 1.
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	ceiling := p.ceiling(attempt)
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// ceiling is BaseBackoff * 2^(attempt-1), capped at MaxBackoff.
+func (p *RetryPolicy) ceiling(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := p.BaseBackoff
+	for i := 1; i < attempt; i++ {
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+		if d > time.Duration(1<<62)/2 {
+			// doubling again would overflow
+			break
+		}
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// Wait sleeps for the backoff of attempt, returning early with the
+// context's error once ctx is done.
+func (p *RetryPolicy) Wait(ctx context.Context, attempt int) error {
+	return sleepCtx(ctx, p.Backoff(attempt))
+}
+
+// Do calls fn until it succeeds, returns an error that is not retryable,
+// or the attempts run out. It returns fn's last error.
+func (p *RetryPolicy) Do(ctx context.Context, fn func(attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil || !p.Retryable(err) || attempt >= p.Attempts() {
+			return err
+		}
+		if werr := p.Wait(ctx, attempt); werr != nil {
+			return err
+		}
+	}
+}
+
+// sleepCtx sleeps for d or until ctx is done, whichever comes first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
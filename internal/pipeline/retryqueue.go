@@ -0,0 +1,171 @@
+package pipeline
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// retryItem is a processed event waiting for its next storage attempt.
+type retryItem struct {
+	event ProcessedEvent
+	// start is when processing of the event began, for latency metrics.
+	start time.Time
+	// attempts is the number of storage attempts made so far.
+	attempts int
+	err      error
+	due      time.Time
+}
+
+// retryHeap is a min-heap of retry items keyed on their due time.
+type retryHeap []*retryItem
+
+func (h retryHeap) Len() int           { return len(h) }
+func (h retryHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+func (h retryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *retryHeap) Push(x interface{}) {
+	*h = append(*h, x.(*retryItem))
+}
+
+func (h *retryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// RetryQueue holds events whose storage attempt failed until their backoff
+// has passed, then hands them back to the workers. Workers never sleep
+// between attempts, so a few failing events cannot starve the pool of
+// fresh ones.
+type RetryQueue struct {
+	mu    sync.Mutex
+	items retryHeap
+	// inflight items were handed to a worker that has not called done yet;
+	// the worker may schedule them again.
+	inflight int
+	closed   bool
+	wake     chan struct{}
+	ready    chan *retryItem
+}
+
+func newRetryQueue() *RetryQueue {
+	return &RetryQueue{
+		wake:  make(chan struct{}, 1),
+		ready: make(chan *retryItem),
+	}
+}
+
+// Len is the number of events waiting for their next attempt.
+func (q *RetryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+func (q *RetryQueue) Start(ctx context.Context) {
+	go q.run(ctx)
+}
+
+// Close tells the queue no new events will enter the pipeline. The ready
+// channel is closed once every waiting event has been handed out and
+// finished, so workers know they can exit.
+func (q *RetryQueue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.signal()
+}
+
+// schedule queues item for another attempt at item.due.
+func (q *RetryQueue) schedule(item *retryItem) {
+	q.mu.Lock()
+	heap.Push(&q.items, item)
+	q.mu.Unlock()
+	q.signal()
+}
+
+// done tells the queue a worker finished with an item it received.
+func (q *RetryQueue) done() {
+	q.mu.Lock()
+	q.inflight--
+	q.mu.Unlock()
+	q.signal()
+}
+
+// drain removes and returns every waiting item. Shutdown uses it to spill
+// the retries it had no time left for.
+func (q *RetryQueue) drain() []*retryItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := make([]*retryItem, 0, len(q.items))
+	for len(q.items) > 0 {
+		items = append(items, heap.Pop(&q.items).(*retryItem))
+	}
+	return items
+}
+
+func (q *RetryQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *RetryQueue) run(ctx context.Context) {
+	for {
+		q.mu.Lock()
+		if q.closed && len(q.items) == 0 && q.inflight == 0 {
+			q.mu.Unlock()
+			close(q.ready)
+			return
+		}
+		var next *retryItem
+		wait := time.Duration(-1)
+		if len(q.items) > 0 {
+			if d := time.Until(q.items[0].due); d > 0 {
+				wait = d
+			} else {
+				next = heap.Pop(&q.items).(*retryItem)
+				q.inflight++
+			}
+		}
+		q.mu.Unlock()
+
+		if next != nil {
+			select {
+			case q.ready <- next:
+			case <-ctx.Done():
+				// put it back so drain finds it
+				q.mu.Lock()
+				heap.Push(&q.items, next)
+				q.inflight--
+				q.mu.Unlock()
+				return
+			}
+			continue
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+		select {
+		case <-q.wake:
+		case <-due:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"event-pipeline/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// StageShutdown marks events spilled because Shutdown ran out of time.
+const StageShutdown = "shutdown"
+
+// errShutdownAborted is recorded on spilled events.
+var errShutdownAborted = errors.New("shutdown deadline exceeded before event was stored")
+
+// ShutdownSummary reports what happened to the events that were queued or
+// in flight when Shutdown started.
+type ShutdownSummary struct {
+	// Drained events finished processing (stored or failed) during shutdown.
+	Drained int `json:"drained"`
+	// Spilled events were written to the spill sink after the deadline.
+	Spilled int `json:"spilled"`
+	// Dropped events could not be spilled either and are lost.
+	Dropped  int  `json:"dropped"`
+	TimedOut bool `json:"timed_out"`
+}
+
+// Shutdown stops accepting events and drains the queue until ctx expires.
+// Past the deadline it aborts retry sleeps and in-flight stores, and
+// spills every event that was not stored to the spill sink. The returned
+// error is ctx's error if the deadline was hit.
+//
+// It is safe to call more than once; later calls wait for the first one
+// to finish (or for their own ctx) and return the same summary.
+func (p *EventPipeline) Shutdown(ctx context.Context) (ShutdownSummary, error) {
+	p.stopOnce.Do(func() { p.shutdown(ctx) })
+
+	// a finished shutdown wins over an expired ctx
+	select {
+	case <-p.stopped:
+		return p.summary, p.stopErr
+	default:
+	}
+	select {
+	case <-p.stopped:
+		return p.summary, p.stopErr
+	case <-ctx.Done():
+		return ShutdownSummary{}, ctx.Err()
+	}
+}
+
+func (p *EventPipeline) shutdown(ctx context.Context) {
+	defer close(p.stopped)
+
+	log := logger.Get()
+	log.Info("initiating graceful shutdown")
+
+	// everything that finishes from here on was drained
+	finishedBefore := p.metrics.GetProcessed() + p.metrics.GetFailed() + p.metrics.GetFiltered()
+
+	// stop new sends, then close channel → lets workers finish draining
+	p.ingestMu.Lock()
+	p.state.Store(StateDraining)
+	queued := p.QueueDepth()
+	switch {
+	case p.partitions != nil:
+		p.partitions.close()
+	case p.lanes != nil:
+		// the dispatcher closes the workers' channel once the lanes are empty
+		p.lanes.Close()
+	default:
+		close(p.ingestionChan)
+	}
+	p.ingestMu.Unlock()
+
+	p.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.drained.Wait()
+		// workers are done adding → flush the last partial batch
+		if p.batcher != nil {
+			p.batcher.Close()
+		}
+		// nothing new can fail now; workers exit once the retries are done
+		p.retries.Close()
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warnw("shutdown deadline exceeded, aborting in-flight work",
+			"queued", p.QueueDepth(),
+			"retrying", p.retries.Len(),
+		)
+		p.stopErr = ctx.Err()
+		p.summary.TimedOut = true
+		p.abortWork()
+		<-done
+	}
+	p.abortWork()
+
+	// workers quit early on abort, whatever is left was never started
+	for _, ev := range p.unstarted() {
+		p.spill(ev, errShutdownAborted)
+	}
+	for _, item := range p.retries.drain() {
+		p.spill(item.event.Event, errShutdownAborted)
+	}
+
+	p.summary.Drained = int(p.metrics.GetProcessed() + p.metrics.GetFailed() + p.metrics.GetFiltered() - finishedBefore)
+	p.summary.Spilled = int(atomic.LoadUint64(&p.spilled))
+	p.summary.Dropped = int(atomic.LoadUint64(&p.dropped))
+	p.state.Store(StateStopped)
+
+	log.Infow("all workers stopped, shutdown complete",
+		"queued_at_shutdown", queued,
+		"drained", p.summary.Drained,
+		"spilled", p.summary.Spilled,
+		"dropped", p.summary.Dropped,
+		"timed_out", p.summary.TimedOut,
+	)
+}
+
+// unstarted collects the events no worker picked up. It must only be
+// called once the workers have stopped.
+func (p *EventPipeline) unstarted() []Event {
+	var events []Event
+	switch {
+	case p.partitions != nil:
+		for _, q := range p.partitions.queues {
+			for ev := range q {
+				events = append(events, ev)
+			}
+		}
+		return events
+	case p.lanes != nil:
+		<-p.lanes.done
+		events = p.lanes.drain()
+	}
+	for ev := range p.ingestionChan {
+		events = append(events, ev)
+	}
+	return events
+}
+
+// aborted reports whether work was cut short by the Shutdown deadline.
+func (p *EventPipeline) aborted() bool {
+	return p.workCtx.Err() != nil
+}
+
+// spill saves an event that shutdown could not finish to the spill sink,
+// falling back to the dead letter sink.
+func (p *EventPipeline) spill(ev Event, cause error) {
+	log := logger.Get()
+
+	sink := p.spillSink
+	if sink == nil {
+		sink = p.deadLetters
+	}
+	if sink == nil {
+		// left unacked, so a WAL hands it back on the next start
+		atomic.AddUint64(&p.dropped, 1)
+		log.Errorw("event dropped on shutdown, no spill sink configured", "event_id", ev.ID)
+		return
+	}
+
+	dl := DeadLetter{
+		ID:       uuid.New().String(),
+		Event:    ev,
+		Stage:    StageShutdown,
+		Error:    cause.Error(),
+		FailedAt: time.Now().UTC(),
+	}
+	// the work context is already cancelled at this point
+	if err := sink.Write(context.Background(), []DeadLetter{dl}); err != nil {
+		atomic.AddUint64(&p.dropped, 1)
+		log.Errorw("event dropped on shutdown, spill failed", "event_id", ev.ID, "error", err)
+		return
+	}
+	atomic.AddUint64(&p.spilled, 1)
+	p.metrics.IncSpilled()
+	p.ack(ev)
+}
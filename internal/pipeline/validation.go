@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+)
+
+// FieldError describes one problem with one field of an event. Field is
+// a JSON pointer into the event, e.g. "/type" or "/data/temperature".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned by validators that can report every
+// violation of an event at once.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Add records a violation.
+func (e *ValidationError) Add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// ErrOrNil returns e if it holds any violation, nil otherwise.
+func (e *ValidationError) ErrOrNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Validate runs the pipeline's validator against ev, so callers such as
+// the API can reject bad events before they are queued.
+func (p *EventPipeline) Validate(ctx context.Context, ev Event) error {
+	return p.validator.Validate(ctx, ev)
+}
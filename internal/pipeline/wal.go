@@ -0,0 +1,312 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"event-pipeline/pkg/logger"
+)
+
+const (
+	walOpAppend = "append"
+	walOpAck    = "ack"
+
+	walSegmentPrefix = "wal-"
+	walSegmentSuffix = ".log"
+)
+
+// walRecord is one line of a WAL segment.
+type walRecord struct {
+	Op    string `json:"op"`
+	Seq   uint64 `json:"seq"`
+	Event *Event `json:"event,omitempty"`
+}
+
+// WAL is a segmented on-disk write-ahead log of accepted events. Ingest
+// appends an event before acknowledging it, and the pipeline acks it once
+// it reached a final outcome (stored, dead-lettered or spilled). Events
+// still unacked when the process dies are handed back by Pending on the
+// next start.
+//
+// Segments are JSON-lines files named wal-<n>.log; a segment is deleted
+// once every event appended to it has been acked and it is no longer the
+// active one.
+type WAL struct {
+	mu          sync.Mutex
+	dir         string
+	segmentSize int64
+	sync        bool
+
+	cur     *os.File
+	curIdx  uint64
+	curSize int64
+	nextSeq uint64
+
+	// seq → segment of every unacked append
+	pending map[uint64]uint64
+	// segment → number of unacked appends in it
+	segPending map[uint64]int
+	// segment indexes on disk, oldest first
+	segments []uint64
+
+	recovered []Event
+}
+
+// OpenWAL opens (or creates) the log in dir and loads the events that were
+// never acked. With syncWrites every append is fsynced before it returns.
+func OpenWAL(dir string, segmentSize int64, syncWrites bool) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create wal dir: %w", err)
+	}
+	if segmentSize <= 0 {
+		segmentSize = 64 << 20
+	}
+
+	w := &WAL{
+		dir:         dir,
+		segmentSize: segmentSize,
+		sync:        syncWrites,
+		nextSeq:     1,
+		pending:     make(map[uint64]uint64),
+		segPending:  make(map[uint64]int),
+	}
+
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+
+	// always start a fresh segment, never append after a possibly torn tail
+	next := uint64(1)
+	if n := len(w.segments); n > 0 {
+		next = w.segments[n-1] + 1
+	}
+	if err := w.openSegment(next); err != nil {
+		return nil, err
+	}
+	w.compact()
+
+	logger.Get().Infow("wal opened",
+		"dir", dir,
+		"segments", len(w.segments),
+		"recovered_events", len(w.recovered),
+	)
+	return w, nil
+}
+
+func (w *WAL) load() error {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read wal dir: %w", err)
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, walSegmentPrefix) || !strings.HasSuffix(name, walSegmentSuffix) {
+			continue
+		}
+		idx, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, walSegmentPrefix), walSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		w.segments = append(w.segments, idx)
+	}
+	sort.Slice(w.segments, func(i, j int) bool { return w.segments[i] < w.segments[j] })
+
+	appended := make(map[uint64]Event)
+	for _, idx := range w.segments {
+		if err := w.readSegment(idx, appended); err != nil {
+			return err
+		}
+	}
+
+	seqs := make([]uint64, 0, len(appended))
+	for seq := range appended {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for _, seq := range seqs {
+		ev := appended[seq]
+		ev.walSeq = seq
+		w.recovered = append(w.recovered, ev)
+	}
+	return nil
+}
+
+func (w *WAL) readSegment(idx uint64, appended map[uint64]Event) error {
+	f, err := os.Open(w.segmentPath(idx))
+	if err != nil {
+		return fmt.Errorf("failed to open wal segment: %w", err)
+	}
+	defer f.Close()
+
+	w.segPending[idx] = 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var rec walRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// a crash mid-write leaves a torn last line; nothing after it
+			// was ever acknowledged
+			logger.Get().Warnw("skipping unreadable wal record",
+				"segment", idx, "line", line, "error", err)
+			continue
+		}
+		if rec.Seq >= w.nextSeq {
+			w.nextSeq = rec.Seq + 1
+		}
+
+		switch rec.Op {
+		case walOpAppend:
+			if rec.Event == nil {
+				continue
+			}
+			appended[rec.Seq] = *rec.Event
+			w.pending[rec.Seq] = idx
+			w.segPending[idx]++
+		case walOpAck:
+			if seg, ok := w.pending[rec.Seq]; ok {
+				delete(appended, rec.Seq)
+				delete(w.pending, rec.Seq)
+				w.segPending[seg]--
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// Pending returns the events found unacked when the log was opened, in
+// append order. They carry their sequence number, so re-ingesting them
+// through the pipeline acks them without appending them again.
+func (w *WAL) Pending() []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Event(nil), w.recovered...)
+}
+
+// Append durably records ev and returns its sequence number. An error
+// means nothing was recorded.
+func (w *WAL) Append(ev Event) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// rotate before writing: a segment that cannot be opened must not fail
+	// an append that already landed, the current one just keeps growing
+	if w.curSize >= w.segmentSize {
+		if err := w.openSegment(w.curIdx + 1); err != nil {
+			logger.Get().Warnw("wal segment rotation failed, staying on the current segment",
+				"segment", w.curIdx, "error", err)
+		}
+	}
+
+	seq := w.nextSeq
+	if err := w.write(walRecord{Op: walOpAppend, Seq: seq, Event: &ev}, w.sync); err != nil {
+		return 0, err
+	}
+	w.nextSeq++
+	w.pending[seq] = w.curIdx
+	w.segPending[w.curIdx]++
+	return seq, nil
+}
+
+// Ack marks seq as done. Acks are not fsynced: losing one only means the
+// event is delivered again after a crash.
+func (w *WAL) Ack(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seg, ok := w.pending[seq]
+	if !ok {
+		return nil
+	}
+	if err := w.write(walRecord{Op: walOpAck, Seq: seq}, false); err != nil {
+		return err
+	}
+	delete(w.pending, seq)
+	w.segPending[seg]--
+	w.compact()
+	return nil
+}
+
+// Unacked returns the number of appended events not yet acked.
+func (w *WAL) Unacked() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
+
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.cur.Sync(); err != nil {
+		return err
+	}
+	return w.cur.Close()
+}
+
+func (w *WAL) write(rec walRecord, sync bool) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal wal record: %w", err)
+	}
+	b = append(b, '\n')
+
+	n, err := w.cur.Write(b)
+	w.curSize += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write wal record: %w", err)
+	}
+	if sync {
+		if err := w.cur.Sync(); err != nil {
+			return fmt.Errorf("failed to sync wal: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *WAL) openSegment(idx uint64) error {
+	f, err := os.OpenFile(w.segmentPath(idx), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open wal segment: %w", err)
+	}
+	if w.cur != nil {
+		_ = w.cur.Sync()
+		_ = w.cur.Close()
+	}
+	w.cur = f
+	w.curIdx = idx
+	w.curSize = 0
+	if _, ok := w.segPending[idx]; !ok {
+		w.segments = append(w.segments, idx)
+		w.segPending[idx] = 0
+	}
+	return nil
+}
+
+// compact deletes fully acked segments from the front of the log. Only a
+// prefix is ever removed, so an ack record can never outlive the segment
+// holding its append.
+func (w *WAL) compact() {
+	for len(w.segments) > 0 {
+		idx := w.segments[0]
+		if idx == w.curIdx || w.segPending[idx] > 0 {
+			return
+		}
+		if err := os.Remove(w.segmentPath(idx)); err != nil && !os.IsNotExist(err) {
+			logger.Get().Warnw("failed to remove wal segment", "segment", idx, "error", err)
+			return
+		}
+		delete(w.segPending, idx)
+		w.segments = w.segments[1:]
+	}
+}
+
+func (w *WAL) segmentPath(idx uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%s%020d%s", walSegmentPrefix, idx, walSegmentSuffix))
+}
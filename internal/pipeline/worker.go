@@ -2,44 +2,69 @@ package pipeline
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
 	"event-pipeline/pkg/logger"
+	"go.uber.org/zap"
 )
 
 type Worker struct {
-	id       int
-	jobChan  <-chan Event
-	pipeline *EventPipeline
-	wg       *sync.WaitGroup
+	id        int
+	jobChan   <-chan Event
+	retryChan <-chan *retryItem
+	pipeline  *EventPipeline
+	wg        *sync.WaitGroup
+	// drained is marked done once the worker saw the ingestion queue close.
+	drained *sync.WaitGroup
+	// quit is closed to stop the worker after the event it holds.
+	quit chan struct{}
 }
 
 func (w *Worker) Start(ctx context.Context) {
 	log := logger.Get().With("worker", w.id)
 
 	w.wg.Add(1)
+	w.drained.Add(1)
 	go func() {
 		defer w.wg.Done()
 
+		jobs := w.jobChan
 		for {
 			select {
-			case job, ok := <-w.jobChan:
+			case job, ok := <-jobs:
+				if !ok {
+					// queue drained, keep serving retries until none are left
+					jobs = nil
+					w.drained.Done()
+					continue
+				}
+				w.pipeline.metrics.IncReceived()
+				w.processJob(ctx, job)
+
+			case item, ok := <-w.retryChan:
 				if !ok {
 					// channel closed, no more jobs
 					log.Infow("worker exiting", "reason", "channel closed")
 					return
 				}
-				w.pipeline.metrics.IncReceived()
-				w.processJob(ctx, job)
+				w.processRetry(ctx, item)
+
+			case <-w.quit:
+				// removed from the pool, the others keep draining the queue
+				if jobs != nil {
+					w.drained.Done()
+				}
+				log.Infow("worker exiting", "reason", "scaled down")
+				return
 
 			case <-ctx.Done():
-				// drain remaining jobs if any
-				for job := range w.jobChan {
-					w.pipeline.metrics.IncReceived()
-					w.processJob(ctx, job)
+				// shutdown deadline hit, the queue is spilled by Shutdown
+				if jobs != nil {
+					w.drained.Done()
 				}
-				log.Infow("worker exiting", "reason", "context cancelled")
+				log.Infow("worker exiting", "reason", "shutdown aborted")
 				return
 			}
 		}
@@ -62,44 +87,205 @@ func (w *Worker) processJob(ctx context.Context, job Event) {
 	if err := w.pipeline.validator.Validate(ctx, job); err != nil {
 		log.Warnw("validation failed", "error", err)
 		w.pipeline.metrics.IncFailed()
+		w.pipeline.deadLetter(ctx, job, StageValidation, err, 1)
 		return
 	}
 
 	// Process
-	processed, err := w.pipeline.processor.Process(ctx, job)
+	outputs, err := w.pipeline.process(ctx, job)
+	if err != nil && w.pipeline.aborted() {
+		log.Warnw("processing aborted by shutdown, spilling event", "error", err)
+		w.pipeline.spill(job, errShutdownAborted)
+		return
+	}
 	if err != nil {
-		log.Errorw("processing failed", "error", err)
 		w.pipeline.metrics.IncFailed()
+		var serr *StageError
+		if errors.As(err, &serr) && serr.Policy == PolicyFail {
+			log.Errorw("processing failed, event discarded", "stage", serr.Stage, "error", err)
+			w.pipeline.ack(job)
+			return
+		}
+		log.Errorw("processing failed", "error", err)
+		w.pipeline.deadLetter(ctx, job, StageProcessing, err, 1)
+		return
+	}
+	if len(outputs) == 0 {
+		log.Infow("event dropped by processor")
+		w.pipeline.metrics.IncFiltered()
+		w.pipeline.ack(job)
 		return
 	}
+	linkOutputs(job, outputs)
 
-	// Store with retries (from config)
-	maxRetries := w.pipeline.cfg.MaxRetries
-	baseBackoff := w.pipeline.cfg.RetryBaseBackoff
+	if b := w.pipeline.batcher; b != nil {
+		for _, out := range outputs {
+			b.Add(out, start)
+		}
+		return
+	}
 
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		err = w.pipeline.storage.Store(ctx, []ProcessedEvent{*processed})
-		if err == nil {
-			break
+	// Store; failures are retried through the retry queue
+	failed := w.pipeline.storeAttempt(ctx, outputs)
+	for i, out := range outputs {
+		if err, ok := failed[i]; ok {
+			w.pipeline.storeFailed(ctx, &retryItem{event: out, start: start, attempts: 1, err: err}, log)
+			continue
 		}
-		log.Warnw("storage attempt failed, will retry",
-			"attempt", attempt,
-			"max_attempts", maxRetries,
-			"error", err,
-		)
-		time.Sleep(time.Duration(attempt) * baseBackoff)
+		w.pipeline.recordStored(out.Event, start)
+	}
+}
+
+// processRetry makes the next storage attempt for an event from the
+// retry queue.
+func (w *Worker) processRetry(ctx context.Context, item *retryItem) {
+	defer w.pipeline.retries.done()
+
+	log := logger.Get().With(
+		"worker", w.id,
+		"event_id", item.event.ID,
+		"type", item.event.Type,
+		"source", item.event.Source,
+	)
+
+	item.attempts++
+	if failed := w.pipeline.storeAttempt(ctx, []ProcessedEvent{item.event}); failed != nil {
+		item.err = failed[0]
+		w.pipeline.storeFailed(ctx, item, log)
+		return
 	}
+	w.pipeline.recordStored(item.event.Event, item.start)
+}
 
+// process runs the pipeline's processor; an empty result means the event
+// was filtered out.
+func (p *EventPipeline) process(ctx context.Context, ev Event) ([]ProcessedEvent, error) {
+	if mp, ok := p.processor.(MultiProcessor); ok {
+		return mp.ProcessAll(ctx, ev)
+	}
+	processed, err := p.processor.Process(ctx, ev)
 	if err != nil {
-		log.Errorw("storage permanently failed", "attempts", maxRetries, "error", err)
-		w.pipeline.metrics.IncFailed()
+		return nil, err
+	}
+	return []ProcessedEvent{*processed}, nil
+}
+
+// linkOutputs gives the events processed from job its WAL checkpoint, even
+// if the processor rebuilt them. Outputs of a fan-out share a counter so
+// the checkpoint is acked only when the last of them is done.
+func linkOutputs(job Event, outputs []ProcessedEvent) {
+	var pending *int32
+	if len(outputs) > 1 {
+		n := int32(len(outputs))
+		pending = &n
+	}
+	for i := range outputs {
+		outputs[i].walSeq = job.walSeq
+		outputs[i].pending = pending
+	}
+}
+
+// storeAttempt writes events to storage once. It returns the error of
+// every event that was not stored, keyed by its index in events; nil means
+// all were stored.
+func (p *EventPipeline) storeAttempt(ctx context.Context, events []ProcessedEvent) map[int]error {
+	err := p.storage.Store(ctx, events)
+	if err == nil {
+		return nil
+	}
+
+	failed := make(map[int]error)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		for i := range events {
+			failed[i] = err
+		}
+		return failed
+	}
+	for i, evErr := range batchErr.Failed {
+		if i >= 0 && i < len(events) {
+			failed[i] = evErr
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return failed
+}
+
+// storeFailed decides what happens to an event whose storage attempt
+// failed: the retry queue schedules another attempt after the policy's
+// backoff if the error is retryable and attempts remain (the partitioned
+// mode retries in place), otherwise it is dead-lettered. Past the shutdown
+// deadline it is spilled instead.
+func (p *EventPipeline) storeFailed(ctx context.Context, item *retryItem, log *zap.SugaredLogger) {
+	if p.aborted() {
+		log.Warnw("storage aborted by shutdown, spilling event", "error", item.err)
+		p.spill(item.event.Event, errShutdownAborted)
 		return
 	}
 
-	// Success
+	policy := p.retry
+	if policy.Retryable(item.err) && item.attempts < policy.Attempts() {
+		if p.partitions != nil {
+			p.retryInPlace(ctx, item, log)
+			return
+		}
+		// an open breaker would reject the retry until its trial calls start
+		backoff := retryAfter(item.err) + policy.Backoff(item.attempts)
+		item.due = time.Now().Add(backoff)
+		p.retries.schedule(item)
+		p.metrics.IncRetries()
+		log.Warnw("storage attempt failed, retry scheduled",
+			"attempt", item.attempts,
+			"max_attempts", policy.Attempts(),
+			"backoff_ms", backoff.Milliseconds(),
+			"error", item.err,
+		)
+		return
+	}
+
+	log.Errorw("storage permanently failed", "attempts", item.attempts, "error", item.err)
+	p.metrics.IncFailed()
+	p.deadLetter(ctx, item.event.Event, StageStorage, item.err, item.attempts)
+}
+
+// retryInPlace waits out the backoff and retries item right away. The
+// partitioned mode uses it instead of the retry queue: later events for
+// the same key wait behind the retry, so they cannot be stored first.
+func (p *EventPipeline) retryInPlace(ctx context.Context, item *retryItem, log *zap.SugaredLogger) {
+	log.Warnw("storage attempt failed, retrying in partition",
+		"attempt", item.attempts,
+		"max_attempts", p.retry.Attempts(),
+		"error", item.err,
+	)
+	p.metrics.IncRetries()
+	if err := sleepCtx(ctx, retryAfter(item.err)+p.retry.Backoff(item.attempts)); err != nil {
+		// only the shutdown deadline cancels ctx
+		p.storeFailed(ctx, item, log)
+		return
+	}
+
+	item.attempts++
+	if failed := p.storeAttempt(ctx, []ProcessedEvent{item.event}); failed != nil {
+		item.err = failed[0]
+		p.storeFailed(ctx, item, log)
+		return
+	}
+	p.recordStored(item.event.Event, item.start)
+}
+
+// recordStored updates the success metrics for an event that reached storage.
+func (p *EventPipeline) recordStored(ev Event, start time.Time) {
+	p.ack(ev)
 	latency := time.Since(start).Milliseconds()
-	w.pipeline.metrics.AddLatency(latency)
-	w.pipeline.metrics.IncProcessed()
+	p.metrics.AddLatency(latency)
+	p.metrics.IncProcessed()
 
-	log.Infow("event processed", "latency_ms", latency)
+	logger.Get().Infow("event processed",
+		"event_id", ev.ID,
+		"type", ev.Type,
+		"source", ev.Source,
+		"latency_ms", latency,
+	)
 }
@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/logger"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// Defaults for breaker settings left at zero.
+const (
+	DefaultBreakerOpen          = 30 * time.Second
+	DefaultBreakerHalfOpenCalls = 1
+)
+
+// BreakerConfig configures a circuit breaker. Failures <= 0 disables it.
+type BreakerConfig struct {
+	// Failures is the number of consecutive failed calls that open the
+	// breaker.
+	Failures int `json:"failures"`
+	// OpenMS is how long the breaker fails fast before letting trial
+	// calls through.
+	OpenMS int `json:"open_ms,omitempty"`
+	// HalfOpenCalls is how many trial calls may run at once, and how
+	// many must succeed to close the breaker again.
+	HalfOpenCalls int `json:"half_open_calls,omitempty"`
+	// Fallback is a spool file that takes the events while the breaker
+	// is open; without one they fail with pipeline.ErrCircuitOpen.
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// Breaker is a Storage that stops calling its backend after repeated
+// failures. While open it fails fast, or hands the events to a fallback
+// sink; after the open timeout a few trial calls decide whether it closes
+// again or reopens.
+//
+// Only failures of the backend itself count: a BatchError or an error
+// marked pipeline.Permanent means the backend answered, and calls
+// cancelled by the caller do not count either way.
+type Breaker struct {
+	name          string
+	store         pipeline.Storage
+	fallback      pipeline.Storage
+	failures      int
+	openFor       time.Duration
+	halfOpenCalls int
+
+	mu          sync.Mutex
+	state       string
+	consecutive int
+	openedAt    time.Time
+	trials      int // trial calls in flight while half-open
+	trialsOK    int
+	stats       pipeline.BreakerStats
+	metrics     *pipeline.Metrics
+}
+
+// NewBreaker wraps store in a closed breaker.
+func NewBreaker(name string, store pipeline.Storage, cfg BreakerConfig) *Breaker {
+	b := &Breaker{
+		name:          name,
+		store:         store,
+		failures:      cfg.Failures,
+		openFor:       time.Duration(cfg.OpenMS) * time.Millisecond,
+		halfOpenCalls: cfg.HalfOpenCalls,
+		state:         BreakerClosed,
+	}
+	if b.openFor <= 0 {
+		b.openFor = DefaultBreakerOpen
+	}
+	if b.halfOpenCalls <= 0 {
+		b.halfOpenCalls = DefaultBreakerHalfOpenCalls
+	}
+	return b
+}
+
+// SetFallback makes the breaker store events in s while it is open.
+func (b *Breaker) SetFallback(s pipeline.Storage) {
+	b.fallback = s
+}
+
+// SetMetrics makes the breaker publish its state, and passes m on to the
+// wrapped storage if it takes metrics too.
+func (b *Breaker) SetMetrics(m *pipeline.Metrics) {
+	b.mu.Lock()
+	b.metrics = m
+	b.publish()
+	b.mu.Unlock()
+
+	if ms, ok := b.store.(interface{ SetMetrics(*pipeline.Metrics) }); ok {
+		ms.SetMetrics(m)
+	}
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State is the current state, moving an open breaker whose timeout has
+// passed to half-open.
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire(time.Now())
+	return b.state
+}
+
+// Stats returns the breaker's counters.
+func (b *Breaker) Stats() pipeline.BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire(time.Now())
+	return b.snapshot()
+}
+
+func (b *Breaker) Store(ctx context.Context, events []pipeline.ProcessedEvent) error {
+	trial, ok := b.allow()
+	if !ok {
+		return b.reject(ctx, events)
+	}
+	err := b.store.Store(ctx, events)
+	b.record(ctx, trial, err, len(events))
+	return err
+}
+
+// allow reports whether a call may reach the backend, and whether it is
+// a half-open trial.
+func (b *Breaker) allow() (trial, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expire(time.Now())
+	switch b.state {
+	case BreakerClosed:
+		return false, true
+	case BreakerHalfOpen:
+		if b.trials < b.halfOpenCalls {
+			b.trials++
+			return true, true
+		}
+	}
+	b.stats.Rejected++
+	b.publish()
+	return false, false
+}
+
+func (b *Breaker) reject(ctx context.Context, events []pipeline.ProcessedEvent) error {
+	if b.fallback == nil {
+		b.mu.Lock()
+		wait := b.openFor - time.Since(b.openedAt)
+		b.mu.Unlock()
+		if wait < 0 {
+			wait = 0
+		}
+		return &pipeline.CircuitOpenError{Name: b.name, RetryAfter: wait}
+	}
+	if err := b.fallback.Store(ctx, events); err != nil {
+		return fmt.Errorf("%s fallback failed: %w", b.name, err)
+	}
+
+	b.mu.Lock()
+	b.stats.Fallback += uint64(len(events))
+	b.publish()
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *Breaker) record(ctx context.Context, trial bool, err error, n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	result := callOutcome(ctx, err, n)
+	if trial {
+		if b.state != BreakerHalfOpen {
+			return
+		}
+		switch result {
+		case callFailed:
+			b.trip("trial call failed", err)
+		case callAborted:
+			// says nothing about the backend, let another call try
+			b.trials--
+		default:
+			b.trialsOK++
+			if b.trialsOK >= b.halfOpenCalls {
+				b.transition(BreakerClosed)
+				logger.Get().Infow("circuit breaker closed", "breaker", b.name)
+			}
+		}
+		b.publish()
+		return
+	}
+
+	if b.state != BreakerClosed {
+		// a call that started before the breaker opened
+		return
+	}
+	switch result {
+	case callOK:
+		if b.consecutive == 0 {
+			return
+		}
+		b.consecutive = 0
+	case callFailed:
+		b.consecutive++
+		if b.consecutive >= b.failures {
+			b.trip("failure threshold reached", err)
+		}
+	default:
+		return
+	}
+	b.publish()
+}
+
+// expire moves an open breaker to half-open once its timeout has passed.
+func (b *Breaker) expire(now time.Time) {
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.openFor {
+		b.transition(BreakerHalfOpen)
+		logger.Get().Infow("circuit breaker half-open, sending trial calls", "breaker", b.name)
+		b.publish()
+	}
+}
+
+func (b *Breaker) trip(reason string, err error) {
+	b.transition(BreakerOpen)
+	b.openedAt = time.Now()
+	b.stats.Trips++
+	logger.Get().Warnw("circuit breaker opened",
+		"breaker", b.name,
+		"reason", reason,
+		"open_for_ms", b.openFor.Milliseconds(),
+		"fallback", b.fallback != nil,
+		"error", err,
+	)
+}
+
+func (b *Breaker) transition(state string) {
+	b.state = state
+	b.consecutive = 0
+	b.trials = 0
+	b.trialsOK = 0
+}
+
+func (b *Breaker) snapshot() pipeline.BreakerStats {
+	st := b.stats
+	st.State = b.state
+	st.ConsecutiveFailures = b.consecutive
+	return st
+}
+
+func (b *Breaker) publish() {
+	if b.metrics != nil {
+		b.metrics.ObserveBreaker(b.name, b.snapshot())
+	}
+}
+
+type callResult int
+
+const (
+	callOK callResult = iota
+	callFailed
+	callAborted
+)
+
+// callOutcome tells whether a call storing n events shows the backend to
+// be healthy. Permanent errors mean the backend answered; calls the caller
+// gave up on tell nothing. A batch error counts as a failure only if every
+// event failed and none of them permanently; an empty batch never does.
+func callOutcome(ctx context.Context, err error, n int) callResult {
+	var batchErr *pipeline.BatchError
+	switch {
+	case err == nil, n == 0:
+		return callOK
+	case ctx.Err() != nil:
+		return callAborted
+	case errors.As(err, &batchErr):
+		if len(batchErr.Failed) < n {
+			return callOK
+		}
+		for _, evErr := range batchErr.Failed {
+			if callOutcome(ctx, evErr, 1) == callOK {
+				return callOK
+			}
+		}
+		return callFailed
+	case pipeline.IsPermanent(err):
+		return callOK
+	}
+	return callFailed
+}
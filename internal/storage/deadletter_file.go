@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/logger"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileDeadLetterSink appends dead letters to a local file, one JSON
+// object per line.
+type FileDeadLetterSink struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func NewFileDeadLetterSink(path string) (*FileDeadLetterSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead letter file: %w", err)
+	}
+
+	logger.Get().Infow("file dead letter sink initialized", "path", path)
+	return &FileDeadLetterSink{path: path, f: f}, nil
+}
+
+func (s *FileDeadLetterSink) Path() string {
+	return s.path
+}
+
+func (s *FileDeadLetterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+func (s *FileDeadLetterSink) Write(_ context.Context, letters []pipeline.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enc := json.NewEncoder(s.f)
+	for _, dl := range letters {
+		if err := enc.Encode(dl); err != nil {
+			return fmt.Errorf("failed to write dead letter: %w", err)
+		}
+	}
+	return s.f.Sync()
+}
+
+func (s *FileDeadLetterSink) List(_ context.Context, filter pipeline.DeadLetterFilter) ([]pipeline.DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.readAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var letters []pipeline.DeadLetter
+	for _, dl := range all {
+		if !filter.Match(dl) {
+			continue
+		}
+		letters = append(letters, dl)
+		if filter.Limit > 0 && len(letters) >= filter.Limit {
+			break
+		}
+	}
+	return letters, nil
+}
+
+// MarkReplayed rewrites the file with the replay outcome applied to the
+// given letters. The new content is written to a temp file and renamed
+// over the original so a crash never leaves a truncated file behind.
+func (s *FileDeadLetterSink) MarkReplayed(_ context.Context, ids []string, status string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.readAll()
+	if err != nil {
+		return err
+	}
+
+	marked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		marked[id] = true
+	}
+	for i := range all {
+		if marked[all[i].ID] {
+			all[i].ReplayStatus = status
+			all[i].ReplayCount++
+			all[i].ReplayedAt = &at
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := json.NewEncoder(tmp)
+	for _, dl := range all {
+		if err := enc.Encode(dl); err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf("failed to write dead letter: %w", err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace dead letter file: %w", err)
+	}
+
+	// the old handle points at the replaced inode
+	_ = s.f.Close()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen dead letter file: %w", err)
+	}
+	s.f = f
+	return nil
+}
+
+func (s *FileDeadLetterSink) readAll() ([]pipeline.DeadLetter, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead letter file: %w", err)
+	}
+	defer f.Close()
+
+	var letters []pipeline.DeadLetter
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var dl pipeline.DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &dl); err != nil {
+			return nil, fmt.Errorf("invalid dead letter on line %d: %w", line, err)
+		}
+		letters = append(letters, dl)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dead letter file: %w", err)
+	}
+	return letters, nil
+}
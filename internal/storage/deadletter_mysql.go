@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/logger"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MySQLDeadLetterSink stores dead letters in the dead_letters table.
+type MySQLDeadLetterSink struct {
+	db *sql.DB
+}
+
+// NewMySQLDeadLetterSink shares the connection pool of an existing
+// MySQLStorage.
+func NewMySQLDeadLetterSink(db *sql.DB) *MySQLDeadLetterSink {
+	return &MySQLDeadLetterSink{db: db}
+}
+
+func (s *MySQLDeadLetterSink) Write(ctx context.Context, letters []pipeline.DeadLetter) error {
+	log := logger.Get().With("component", "mysql_dead_letters")
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Errorw("begin transaction failed", "error", err)
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO dead_letters
+		(id, event_id, type, source, stage, error, attempts, event, failed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Errorw("prepare statement failed", "error", err)
+		return err
+	}
+	defer stmt.Close()
+
+	for _, dl := range letters {
+		eventBytes, err := json.Marshal(dl.Event)
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+
+		_, err = stmt.ExecContext(ctx,
+			dl.ID,
+			dl.Event.ID,
+			dl.Event.Type,
+			dl.Event.Source,
+			dl.Stage,
+			dl.Error,
+			dl.Attempts,
+			string(eventBytes),
+			dl.FailedAt,
+		)
+		if err != nil {
+			_ = tx.Rollback()
+			log.Errorw("insert failed",
+				"event_id", dl.Event.ID,
+				"stage", dl.Stage,
+				"error", err,
+			)
+			return fmt.Errorf("insert failed: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorw("transaction commit failed", "error", err)
+		return err
+	}
+
+	log.Debugw("dead letters stored", "count", len(letters))
+	return nil
+}
+
+func (s *MySQLDeadLetterSink) List(ctx context.Context, filter pipeline.DeadLetterFilter) ([]pipeline.DeadLetter, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if filter.Stage != "" {
+		where = append(where, "stage = ?")
+		args = append(args, filter.Stage)
+	}
+	if filter.Type != "" {
+		where = append(where, "type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.Source != "" {
+		where = append(where, "source = ?")
+		args = append(args, filter.Source)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "failed_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "failed_at < ?")
+		args = append(args, filter.Until)
+	}
+	if !filter.IncludeReplayed {
+		where = append(where, "(replay_status IS NULL OR replay_status <> ?)")
+		args = append(args, pipeline.ReplayStatusReplayed)
+	}
+
+	query := `SELECT id, stage, error, attempts, event, failed_at, replay_status, replay_count, replayed_at
+		FROM dead_letters`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY failed_at"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query dead letters failed: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []pipeline.DeadLetter
+	for rows.Next() {
+		var (
+			dl           pipeline.DeadLetter
+			rawEvent     []byte
+			replayStatus sql.NullString
+			replayedAt   sql.NullTime
+		)
+		if err := rows.Scan(&dl.ID, &dl.Stage, &dl.Error, &dl.Attempts, &rawEvent,
+			&dl.FailedAt, &replayStatus, &dl.ReplayCount, &replayedAt); err != nil {
+			return nil, fmt.Errorf("scan dead letter failed: %w", err)
+		}
+		if err := json.Unmarshal(rawEvent, &dl.Event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal event of dead letter %s: %w", dl.ID, err)
+		}
+		dl.ReplayStatus = replayStatus.String
+		if replayedAt.Valid {
+			t := replayedAt.Time
+			dl.ReplayedAt = &t
+		}
+		letters = append(letters, dl)
+	}
+	return letters, rows.Err()
+}
+
+func (s *MySQLDeadLetterSink) MarkReplayed(ctx context.Context, ids []string, status string, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := []interface{}{status, at}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE dead_letters
+		SET replay_status = ?, replayed_at = ?, replay_count = replay_count + 1
+		WHERE id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return fmt.Errorf("update dead letters failed: %w", err)
+	}
+	return nil
+}
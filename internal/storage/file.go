@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/logger"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStorage archives processed events to a local file, one JSON object
+// per line. It is meant as a cheap sink for high-volume types such as
+// system_log that do not need to be queried from MySQL.
+type FileStorage struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func NewFileStorage(path string) (*FileStorage, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create archive directory: %w", err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive file: %w", err)
+	}
+
+	logger.Get().Infow("file storage initialized", "path", path)
+	return &FileStorage{path: path, f: f}, nil
+}
+
+func (s *FileStorage) Path() string {
+	return s.path
+}
+
+func (s *FileStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// Store appends events and syncs the file. Events that cannot be encoded
+// fail on their own; a write error fails the whole batch.
+func (s *FileStorage) Store(_ context.Context, events []pipeline.ProcessedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failed := make(map[int]error)
+	for i, e := range events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			failed[i] = fmt.Errorf("failed to marshal event: %w", err)
+			continue
+		}
+		if _, err := s.f.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := s.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync archive: %w", err)
+	}
+
+	if len(failed) > 0 {
+		return &pipeline.BatchError{Failed: failed}
+	}
+	return nil
+}
@@ -3,16 +3,25 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"event-pipeline/internal/pipeline"
 	"event-pipeline/pkg/logger"
 	"fmt"
+	"strings"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
+// ErrUnknownEventType is returned for an event whose type is not in the
+// storage's allowed types.
+var ErrUnknownEventType = errors.New("unknown event type")
+
 type MySQLStorage struct {
-	db *sql.DB
+	db      *sql.DB
+	metrics *pipeline.Metrics
+	types   *pipeline.EventTypes
 }
 
 func NewMySQLStorage(dsn string) (*MySQLStorage, error) {
@@ -28,6 +37,141 @@ func NewMySQLStorage(dsn string) (*MySQLStorage, error) {
 	return &MySQLStorage{db: db}, nil
 }
 
+// SetMetrics makes the storage count rows skipped as duplicates.
+func (s *MySQLStorage) SetMetrics(m *pipeline.Metrics) {
+	s.metrics = m
+}
+
+// SetEventTypes makes Store fail events of other types without sending
+// them to MySQL.
+func (s *MySQLStorage) SetEventTypes(types *pipeline.EventTypes) {
+	s.types = types
+}
+
+// CheckEventTypes compares the processed_events.type ENUM with types and
+// logs a warning for every difference. It returns the column's values.
+func (s *MySQLStorage) CheckEventTypes(ctx context.Context, types *pipeline.EventTypes) ([]string, error) {
+	log := logger.Get().With("component", "mysql_storage")
+
+	var columnType string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COLUMN_TYPE FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'processed_events' AND COLUMN_NAME = 'type'
+	`).Scan(&columnType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read processed_events.type definition: %w", err)
+	}
+
+	column, ok := ParseEnumValues(columnType)
+	if !ok {
+		// a VARCHAR column takes any type
+		log.Infow("processed_events.type is not an ENUM, skipping type check", "column_type", columnType)
+		return nil, nil
+	}
+
+	inColumn := make(map[string]bool, len(column))
+	for _, t := range column {
+		inColumn[t] = true
+		if !types.Allowed(t) {
+			log.Warnw("event type in processed_events.type ENUM is not configured", "type", t)
+		}
+	}
+	for _, t := range types.List() {
+		if !inColumn[t] {
+			log.Warnw("configured event type missing from processed_events.type ENUM, inserts will fail",
+				"type", t, "column_type", columnType)
+		}
+	}
+	return column, nil
+}
+
+// ParseEnumValues extracts the values of a MySQL column definition such
+// as "enum('a','b')". ok is false for any other column type.
+func ParseEnumValues(columnType string) (values []string, ok bool) {
+	lower := strings.ToLower(columnType)
+	if !strings.HasPrefix(lower, "enum(") || !strings.HasSuffix(lower, ")") {
+		return nil, false
+	}
+	body := columnType[len("enum(") : len(columnType)-1]
+
+	var cur strings.Builder
+	inQuote := false
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\'' && inQuote && i+1 < len(body) && body[i+1] == '\'':
+			// '' is an escaped quote
+			cur.WriteByte('\'')
+			i++
+		case c == '\'':
+			if inQuote {
+				values = append(values, cur.String())
+				cur.Reset()
+			}
+			inQuote = !inQuote
+		case inQuote:
+			cur.WriteByte(c)
+		}
+	}
+	return values, !inQuote
+}
+
+// permanentMySQLErrors are server errors caused by the row itself, which
+// fail the same way however often the insert is retried.
+var permanentMySQLErrors = map[uint16]bool{
+	1048: true, // ER_BAD_NULL_ERROR: column cannot be null
+	1054: true, // ER_BAD_FIELD_ERROR: unknown column
+	1064: true, // ER_PARSE_ERROR
+	1146: true, // ER_NO_SUCH_TABLE
+	1264: true, // ER_WARN_DATA_OUT_OF_RANGE
+	1265: true, // WARN_DATA_TRUNCATED: e.g. a value not in an ENUM
+	1292: true, // ER_TRUNCATED_WRONG_VALUE: e.g. a malformed datetime
+	1366: true, // ER_TRUNCATED_WRONG_VALUE_FOR_FIELD: e.g. bad utf8
+	1406: true, // ER_DATA_TOO_LONG
+	1452: true, // ER_NO_REFERENCED_ROW_2: foreign key violation
+	3140: true, // ER_INVALID_JSON_TEXT
+	3819: true, // ER_CHECK_CONSTRAINT_VIOLATED
+}
+
+// ClassifyMySQLError classifies err by its MySQL error code: errors caused
+// by the row are permanent, server and connection trouble (deadlocks, lock
+// wait timeouts, too many connections, a lost connection) is retryable.
+// Errors that are not from MySQL get pipeline.ClassifyError.
+func ClassifyMySQLError(err error) pipeline.ErrorClass {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		if permanentMySQLErrors[myErr.Number] {
+			return pipeline.ErrorPermanent
+		}
+		return pipeline.ErrorRetryable
+	}
+	return pipeline.ClassifyError(err)
+}
+
+// markPermanent wraps err with pipeline.Permanent if MySQL says retrying
+// cannot help, so the classification survives wrappers such as a Router.
+func markPermanent(err error) error {
+	if ClassifyMySQLError(err) == pipeline.ErrorPermanent && !pipeline.IsPermanent(err) {
+		return pipeline.Permanent(err)
+	}
+	return err
+}
+
+// rowError reports whether err failed only the statement that caused it.
+// Anything else may have ended the transaction: InnoDB rolls back all of
+// it on a deadlock (1213) and, with innodb_rollback_on_timeout, on a lock
+// wait timeout (1205), and a lost connection takes it along.
+func rowError(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) && (myErr.Number == 1213 || myErr.Number == 1205) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return false
+	}
+	return ClassifyMySQLError(err) == pipeline.ErrorPermanent
+}
+
 func (s *MySQLStorage) DB() *sql.DB {
 	return s.db
 }
@@ -38,6 +182,9 @@ func (s *MySQLStorage) Close() error {
 
 func (s *MySQLStorage) Store(ctx context.Context, events []pipeline.ProcessedEvent) error {
 	log := logger.Get().With("component", "mysql_storage")
+	if len(events) == 0 {
+		return nil
+	}
 
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -49,6 +196,7 @@ func (s *MySQLStorage) Store(ctx context.Context, events []pipeline.ProcessedEve
 		INSERT INTO processed_events
 		(id, type, source, user_id, processed_data, processing_time_ms, created_at, processed_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE id = id
 	`)
 	if err != nil {
 		_ = tx.Rollback()
@@ -57,18 +205,29 @@ func (s *MySQLStorage) Store(ctx context.Context, events []pipeline.ProcessedEve
 	}
 	defer stmt.Close()
 
-	for _, e := range events {
+	// A row error such as bad utf8 or an overlong value rolls back only its
+	// statement, so a bad row does not poison the rest of the batch: collect
+	// per-row errors and commit the rows that made it. Any other error may
+	// have rolled back the rows already written, so the whole batch fails.
+	failed := make(map[int]error)
+	for i, e := range events {
+		if s.types != nil && !s.types.Allowed(e.Type) {
+			log.Errorw("event type not allowed", "event_id", e.ID, "type", e.Type)
+			failed[i] = pipeline.Permanent(fmt.Errorf("%w %q", ErrUnknownEventType, e.Type))
+			continue
+		}
+
 		dataBytes, err := json.Marshal(e.Data)
 		if err != nil {
-			_ = tx.Rollback()
 			log.Errorw("failed to marshal event data",
 				"event_id", e.ID,
 				"error", err,
 			)
-			return fmt.Errorf("failed to marshal data: %w", err)
+			failed[i] = pipeline.Permanent(fmt.Errorf("failed to marshal data: %w", err))
+			continue
 		}
 
-		_, err = stmt.ExecContext(ctx,
+		res, err := stmt.ExecContext(ctx,
 			e.ID,
 			e.Type,
 			e.Source,
@@ -78,15 +237,33 @@ func (s *MySQLStorage) Store(ctx context.Context, events []pipeline.ProcessedEve
 			e.Timestamp,
 			e.ProcessedAt,
 		)
-		if err != nil {
+		if err != nil && !rowError(err) {
 			_ = tx.Rollback()
+			log.Errorw("insert failed, batch rolled back",
+				"event_id", e.ID,
+				"count", len(events),
+				"error", err,
+			)
+			return fmt.Errorf("insert failed: %w", err)
+		}
+		if err != nil {
 			log.Errorw("insert failed",
 				"event_id", e.ID,
 				"type", e.Type,
 				"source", e.Source,
 				"error", err,
 			)
-			return fmt.Errorf("insert failed: %w", err)
+			failed[i] = markPermanent(fmt.Errorf("insert failed: %w", err))
+			continue
+		}
+
+		// a retried or replayed event already stored is a success, not an error
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			log.Infow("duplicate event skipped", "event_id", e.ID)
+			if s.metrics != nil {
+				s.metrics.IncDuplicates()
+			}
+			continue
 		}
 
 		log.Debugw("event stored",
@@ -97,11 +274,24 @@ func (s *MySQLStorage) Store(ctx context.Context, events []pipeline.ProcessedEve
 		)
 	}
 
+	if len(failed) == len(events) {
+		_ = tx.Rollback()
+		if len(events) == 1 {
+			return failed[0]
+		}
+		return &pipeline.BatchError{Failed: failed}
+	}
+
 	if err := tx.Commit(); err != nil {
 		log.Errorw("transaction commit failed", "error", err)
 		return err
 	}
 
+	if len(failed) > 0 {
+		log.Warnw("batch partially stored", "count", len(events), "failed", len(failed))
+		return &pipeline.BatchError{Failed: failed}
+	}
+
 	log.Infow("batch stored successfully", "count", len(events))
 	return nil
 }
@@ -0,0 +1,451 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/logger"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoRoute is returned for an event that matches no route when the
+// router has no default sinks.
+var ErrNoRoute = errors.New("no route for event")
+
+// Sink types a RouterConfig can open.
+const (
+	SinkMySQL = "mysql"
+	SinkFile  = "file"
+)
+
+// Defaults for sinks that do not set their own retry policy and for how
+// long partial deliveries are remembered.
+const (
+	DefaultSinkRetries    = 3
+	DefaultSinkBackoff    = 20 * time.Millisecond
+	DefaultSinkMaxBackoff = 2 * time.Second
+	DefaultDeliveredTTL   = 10 * time.Minute
+)
+
+// RouterConfig is the file read by LoadRouterConfig:
+//
+//	{
+//	  "sinks": {
+//	    "mysql":   {"type": "mysql", "max_retries": 3, "backoff_ms": 20},
+//	    "archive": {"type": "file", "path": "archive/events.jsonl", "optional": true}
+//	  },
+//	  "routes": [
+//	    {"name": "logs", "types": ["system_log"], "sinks": ["archive"]},
+//	    {"name": "alerts", "data": {"route": "alerts"}, "sinks": ["mysql", "archive"]}
+//	  ],
+//	  "default": ["mysql"]
+//	}
+//
+// Routes are tried in order and the first match wins; events matching
+// none go to the default sinks.
+type RouterConfig struct {
+	Sinks   map[string]SinkConfig `json:"sinks"`
+	Routes  []Route               `json:"routes"`
+	Default []string              `json:"default,omitempty"`
+	// DeliveredTTLMS is how long a delivery to one sink is remembered
+	// while another sink of the same event still fails.
+	DeliveredTTLMS int `json:"delivered_ttl_ms,omitempty"`
+}
+
+// SinkConfig describes one storage sink.
+type SinkConfig struct {
+	Type string `json:"type"`
+	Path string `json:"path,omitempty"`
+	// MaxRetries is the number of attempts per delivery, like MAX_RETRIES.
+	// Waits start at BackoffMS and double up to MaxBackoffMS, with jitter;
+	// permanent errors are not retried.
+	MaxRetries   int `json:"max_retries,omitempty"`
+	BackoffMS    int `json:"backoff_ms,omitempty"`
+	MaxBackoffMS int `json:"max_backoff_ms,omitempty"`
+	// Optional sinks are best effort: their failures are counted but do
+	// not fail the event.
+	Optional bool `json:"optional,omitempty"`
+	// Breaker wraps the sink in a circuit breaker.
+	Breaker *BreakerConfig `json:"breaker,omitempty"`
+}
+
+// Route sends matching events to Sinks. All conditions given must hold:
+// Types and Sources list accepted values, Data maps dotted Data fields to
+// a value or a list of accepted values.
+type Route struct {
+	Name    string                 `json:"name"`
+	Types   []string               `json:"types,omitempty"`
+	Sources []string               `json:"sources,omitempty"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+	Sinks   []string               `json:"sinks"`
+}
+
+// LoadRouterConfig reads and checks a router config from path.
+func LoadRouterConfig(path string) (*RouterConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routes: %w", err)
+	}
+	var cfg RouterConfig
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid routes: %w", err)
+	}
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (cfg *RouterConfig) check() error {
+	for name, sc := range cfg.Sinks {
+		switch sc.Type {
+		case SinkMySQL:
+		case SinkFile:
+			if sc.Path == "" {
+				return fmt.Errorf("sink %s: a file sink needs a path", name)
+			}
+		default:
+			return fmt.Errorf("sink %s: unknown type %q", name, sc.Type)
+		}
+	}
+	for i, r := range cfg.Routes {
+		if len(r.Sinks) == 0 {
+			return fmt.Errorf("route %d (%s): no sinks", i, r.Name)
+		}
+		for _, s := range r.Sinks {
+			if _, ok := cfg.Sinks[s]; !ok {
+				return fmt.Errorf("route %d (%s): unknown sink %q", i, r.Name, s)
+			}
+		}
+	}
+	for _, s := range cfg.Default {
+		if _, ok := cfg.Sinks[s]; !ok {
+			return fmt.Errorf("default route: unknown sink %q", s)
+		}
+	}
+	return nil
+}
+
+// OpenSinks opens the sinks of cfg, each behind its breaker if it has
+// one. MySQL sinks share mysql; the returned func closes the files opened.
+func OpenSinks(cfg RouterConfig, mysql pipeline.Storage) (map[string]pipeline.Storage, func(), error) {
+	sinks := make(map[string]pipeline.Storage, len(cfg.Sinks))
+	files := make(map[string]*FileStorage)
+	closeAll := func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}
+	// sinks sharing a spool file share the handle
+	openFile := func(path string) (*FileStorage, error) {
+		if f, ok := files[path]; ok {
+			return f, nil
+		}
+		f, err := NewFileStorage(path)
+		if err != nil {
+			return nil, err
+		}
+		files[path] = f
+		return f, nil
+	}
+
+	for name, sc := range cfg.Sinks {
+		var sink pipeline.Storage
+		switch sc.Type {
+		case SinkMySQL:
+			if mysql == nil {
+				closeAll()
+				return nil, func() {}, fmt.Errorf("sink %s: no MySQL storage", name)
+			}
+			sink = mysql
+		case SinkFile:
+			f, err := openFile(sc.Path)
+			if err != nil {
+				closeAll()
+				return nil, func() {}, fmt.Errorf("sink %s: %w", name, err)
+			}
+			sink = f
+		default:
+			closeAll()
+			return nil, func() {}, fmt.Errorf("sink %s: unknown type %q", name, sc.Type)
+		}
+
+		if sc.Breaker != nil && sc.Breaker.Failures > 0 {
+			b := NewBreaker(name, sink, *sc.Breaker)
+			if sc.Breaker.Fallback != "" {
+				spool, err := openFile(sc.Breaker.Fallback)
+				if err != nil {
+					closeAll()
+					return nil, func() {}, fmt.Errorf("sink %s: %w", name, err)
+				}
+				b.SetFallback(spool)
+			}
+			sink = b
+		}
+		sinks[name] = sink
+	}
+	return sinks, closeAll, nil
+}
+
+// Router is a Storage that dispatches events to sinks by content. Each
+// sink is written concurrently with its own retry policy and counters.
+// An event is stored once every non-optional sink of its route has it;
+// sinks that already took the event are skipped when the pipeline
+// retries it, so only the failed deliveries are repeated.
+type Router struct {
+	routes    []Route
+	fallback  []string
+	sinks     map[string]*routerSink
+	delivered *pipeline.DedupCache
+	metrics   *pipeline.Metrics
+}
+
+type routerSink struct {
+	name  string
+	store pipeline.Storage
+	cfg   SinkConfig
+	retry *pipeline.RetryPolicy
+}
+
+func (sc SinkConfig) retryPolicy() *pipeline.RetryPolicy {
+	attempts := sc.MaxRetries
+	if attempts < 1 {
+		attempts = DefaultSinkRetries
+	}
+	backoff := time.Duration(sc.BackoffMS) * time.Millisecond
+	if backoff <= 0 {
+		backoff = DefaultSinkBackoff
+	}
+	max := time.Duration(sc.MaxBackoffMS) * time.Millisecond
+	if max <= 0 {
+		max = DefaultSinkMaxBackoff
+	}
+	return pipeline.NewRetryPolicy(attempts, backoff, max)
+}
+
+// NewRouter builds a router over sinks, keyed by the sink names of cfg.
+func NewRouter(cfg RouterConfig, sinks map[string]pipeline.Storage) (*Router, error) {
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+
+	ttl := time.Duration(cfg.DeliveredTTLMS) * time.Millisecond
+	if ttl <= 0 {
+		ttl = DefaultDeliveredTTL
+	}
+	r := &Router{
+		routes:    cfg.Routes,
+		fallback:  cfg.Default,
+		sinks:     make(map[string]*routerSink, len(cfg.Sinks)),
+		delivered: pipeline.NewDedupCache(ttl, 100000),
+	}
+	for name, sc := range cfg.Sinks {
+		store, ok := sinks[name]
+		if !ok {
+			return nil, fmt.Errorf("sink %s: no storage", name)
+		}
+		r.sinks[name] = &routerSink{name: name, store: store, cfg: sc, retry: sc.retryPolicy()}
+	}
+	return r, nil
+}
+
+// SetMetrics makes the router report per-sink deliveries, and passes m on
+// to the sinks that take metrics too.
+func (r *Router) SetMetrics(m *pipeline.Metrics) {
+	r.metrics = m
+	for _, s := range r.sinks {
+		if ms, ok := s.store.(interface{ SetMetrics(*pipeline.Metrics) }); ok {
+			ms.SetMetrics(m)
+		}
+	}
+}
+
+// Route returns the sinks an event goes to.
+func (r *Router) Route(e pipeline.Event) []string {
+	for _, rt := range r.routes {
+		if rt.matches(e) {
+			return rt.Sinks
+		}
+	}
+	return r.fallback
+}
+
+func (r *Router) Store(ctx context.Context, events []pipeline.ProcessedEvent) error {
+	log := logger.Get().With("component", "router")
+
+	failed := make(map[int]error)
+	routes := make([][]string, len(events))
+	bySink := make(map[string][]int)
+	for i, e := range events {
+		routes[i] = r.Route(e.Event)
+		if len(routes[i]) == 0 {
+			failed[i] = fmt.Errorf("%w (type %q, source %q)", ErrNoRoute, e.Type, e.Source)
+			continue
+		}
+		for _, name := range routes[i] {
+			if r.delivered.Has(deliveryKey(name, e.ID)) {
+				continue
+			}
+			bySink[name] = append(bySink[name], i)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, idxs := range bySink {
+		wg.Add(1)
+		go func(s *routerSink, idxs []int) {
+			defer wg.Done()
+			errs := r.deliver(ctx, s, events, idxs)
+			if len(errs) == 0 {
+				return
+			}
+			if s.cfg.Optional {
+				log.Warnw("optional sink failed", "sink", s.name, "failed", len(errs))
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for idx, err := range errs {
+				if _, ok := failed[idx]; !ok {
+					failed[idx] = fmt.Errorf("sink %s: %w", s.name, err)
+				}
+			}
+		}(r.sinks[name], idxs)
+	}
+	wg.Wait()
+
+	// deliveries are only remembered until the whole event is stored
+	for i, e := range events {
+		if _, ok := failed[i]; ok {
+			continue
+		}
+		for _, name := range routes[i] {
+			r.delivered.Forget(deliveryKey(name, e.ID))
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	if len(events) == 1 {
+		return failed[0]
+	}
+	return &pipeline.BatchError{Failed: failed}
+}
+
+// deliver writes events[idxs] to one sink, retrying the ones that failed
+// with a retryable error as the sink's policy allows. It returns the
+// errors of those that could not be written, keyed by their index in
+// events; the pipeline's retry queue takes over from there.
+func (r *Router) deliver(ctx context.Context, s *routerSink, events []pipeline.ProcessedEvent, idxs []int) map[int]error {
+	pending := idxs
+	failed := make(map[int]error)
+	retries := 0
+	for attempt := 1; ; attempt++ {
+		batch := make([]pipeline.ProcessedEvent, len(pending))
+		for i, idx := range pending {
+			batch[i] = events[idx]
+		}
+
+		err := s.store.Store(ctx, batch)
+		var batchErr *pipeline.BatchError
+		var retry []int
+		for i, idx := range pending {
+			evErr := err
+			if errors.As(err, &batchErr) {
+				evErr = batchErr.Failed[i]
+			}
+			if evErr == nil {
+				delete(failed, idx)
+				r.delivered.Seen(deliveryKey(s.name, events[idx].ID))
+				continue
+			}
+			failed[idx] = evErr
+			// an open breaker is waited out by the pipeline's retry queue
+			if s.retry.Retryable(evErr) && !errors.Is(evErr, pipeline.ErrCircuitOpen) {
+				retry = append(retry, idx)
+			}
+		}
+		pending = retry
+
+		if len(pending) == 0 || attempt >= s.retry.Attempts() || s.retry.Wait(ctx, attempt) != nil {
+			break
+		}
+		retries++
+	}
+
+	if r.metrics != nil {
+		r.metrics.ObserveSink(s.name, len(idxs)-len(failed), len(failed), retries)
+	}
+	return failed
+}
+
+func deliveryKey(sink, eventID string) string {
+	return sink + "/" + eventID
+}
+
+func (rt Route) matches(e pipeline.Event) bool {
+	if len(rt.Types) > 0 && !contains(rt.Types, e.Type) {
+		return false
+	}
+	if len(rt.Sources) > 0 && !contains(rt.Sources, e.Source) {
+		return false
+	}
+	for path, want := range rt.Data {
+		got, ok := dataField(e.Data, path)
+		if !ok {
+			return false
+		}
+		if alts, isList := want.([]interface{}); isList {
+			if !containsValue(alts, got) {
+				return false
+			}
+		} else if !reflect.DeepEqual(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// dataField reads a dotted path from data.
+func dataField(data map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = data
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(list []interface{}, v interface{}) bool {
+	for _, alt := range list {
+		if reflect.DeepEqual(alt, v) {
+			return true
+		}
+	}
+	return false
+}
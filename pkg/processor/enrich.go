@@ -0,0 +1,349 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"event-pipeline/internal/pipeline"
+)
+
+// DefaultLookupTTL is how long lookup results are cached when the config
+// does not say.
+const DefaultLookupTTL = time.Minute
+
+// EnrichConfig is the file read by LoadEnricher:
+//
+//	{
+//	  "on_error": "skip",
+//	  "cache_ttl_ms": 60000,
+//	  "cache_max_keys": 10000,
+//	  "lookups": [
+//	    {"name": "users", "key": "user_id", "table": "user_profiles",
+//	     "key_column": "user_id", "fields": ["tier", "country"], "target": "user"},
+//	    {"name": "devices", "key": "data.device_id", "file": "devices.csv",
+//	     "types": ["sensor_data"], "target": "device"}
+//	  ]
+//	}
+//
+// Lookups run in order, so a later key may be a field an earlier lookup
+// added.
+type EnrichConfig struct {
+	OnError      pipeline.ErrorPolicy `json:"on_error,omitempty"`
+	CacheTTLMS   int                  `json:"cache_ttl_ms,omitempty"`
+	CacheMaxKeys int                  `json:"cache_max_keys,omitempty"`
+	Lookups      []LookupConfig       `json:"lookups"`
+}
+
+// LookupConfig joins events with one reference table.
+type LookupConfig struct {
+	Name string `json:"name"`
+	// Key is where the lookup key comes from: id, type, source, user_id,
+	// or data.<field>.
+	Key string `json:"key"`
+	// Types limits the lookup to these event types; empty means all.
+	Types []string `json:"types,omitempty"`
+	// File is a CSV or JSON table, Table a MySQL table; set one of them.
+	File      string `json:"file,omitempty"`
+	Table     string `json:"table,omitempty"`
+	KeyColumn string `json:"key_column,omitempty"`
+	// Fields are the columns merged into the event, all of them if empty.
+	Fields []string `json:"fields,omitempty"`
+	// Target is the Data object the fields are merged into, the top level
+	// of Data if empty. Fields the event already has are kept.
+	Target string `json:"target,omitempty"`
+	// Required makes a key missing from the table an error, handled by
+	// the stage's error policy; otherwise the event passes unenriched.
+	Required bool `json:"required,omitempty"`
+}
+
+type lookup struct {
+	cfg   LookupConfig
+	table LookupTable
+	cache *lookupCache
+}
+
+// Enricher merges rows from lookup tables into Event.Data. It is both a
+// Processor and a pipeline.Stage. Every table sits behind a TTL cache
+// that also remembers missing keys.
+type Enricher struct {
+	onError pipeline.ErrorPolicy
+	lookups []*lookup
+	metrics *pipeline.Metrics
+}
+
+// LoadEnricher reads an enrichment config from path. db serves table
+// lookups and may be nil if there are none.
+func LoadEnricher(path string, db *sql.DB) (*Enricher, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read enrichment config: %w", err)
+	}
+	var cfg EnrichConfig
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid enrichment config: %w", err)
+	}
+	return NewEnricher(cfg, db)
+}
+
+// NewEnricher opens the tables of cfg.
+func NewEnricher(cfg EnrichConfig, db *sql.DB) (*Enricher, error) {
+	tables := make(map[string]LookupTable, len(cfg.Lookups))
+	for _, lc := range cfg.Lookups {
+		if lc.Name == "" {
+			return nil, fmt.Errorf("lookup needs a name")
+		}
+		if _, dup := tables[lc.Name]; dup {
+			return nil, fmt.Errorf("duplicate lookup %q", lc.Name)
+		}
+
+		var table LookupTable
+		var err error
+		switch {
+		case lc.File != "" && lc.Table != "":
+			err = fmt.Errorf("set file or table, not both")
+		case lc.File != "":
+			table, err = LoadFileTable(lc.File, lc.KeyColumn)
+		case lc.Table != "":
+			if lc.KeyColumn == "" {
+				err = fmt.Errorf("a table lookup needs key_column")
+				break
+			}
+			table, err = NewSQLTable(db, lc.Table, lc.KeyColumn, lc.Fields)
+		default:
+			err = fmt.Errorf("needs a file or a table")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("lookup %s: %w", lc.Name, err)
+		}
+		tables[lc.Name] = table
+	}
+	return newEnricher(cfg, tables)
+}
+
+// NewEnricherWithTables is NewEnricher with the tables given by lookup
+// name instead of opened from File or Table.
+func NewEnricherWithTables(cfg EnrichConfig, tables map[string]LookupTable) (*Enricher, error) {
+	return newEnricher(cfg, tables)
+}
+
+func newEnricher(cfg EnrichConfig, tables map[string]LookupTable) (*Enricher, error) {
+	if err := checkPolicy(cfg.OnError); err != nil {
+		return nil, err
+	}
+	ttl := time.Duration(cfg.CacheTTLMS) * time.Millisecond
+	if ttl <= 0 {
+		ttl = DefaultLookupTTL
+	}
+
+	en := &Enricher{onError: cfg.OnError}
+	for _, lc := range cfg.Lookups {
+		if !validKey(lc.Key) {
+			return nil, fmt.Errorf("lookup %s: invalid key %q", lc.Name, lc.Key)
+		}
+		table, ok := tables[lc.Name]
+		if !ok {
+			return nil, fmt.Errorf("lookup %s: no table", lc.Name)
+		}
+		en.lookups = append(en.lookups, &lookup{
+			cfg:   lc,
+			table: table,
+			cache: newLookupCache(ttl, cfg.CacheMaxKeys),
+		})
+	}
+	return en, nil
+}
+
+func validKey(key string) bool {
+	switch key {
+	case "id", "type", "source", "user_id":
+		return true
+	}
+	return strings.HasPrefix(key, "data.") && len(key) > len("data.")
+}
+
+// SetMetrics makes the enricher report cache hits and missing keys.
+func (en *Enricher) SetMetrics(m *pipeline.Metrics) {
+	en.metrics = m
+}
+
+// OnError is the error policy the config asks for.
+func (en *Enricher) OnError() pipeline.ErrorPolicy {
+	return en.onError
+}
+
+// Reload re-reads the file tables and empties every cache, so edited
+// reference data is picked up at once. A table that fails to load keeps
+// its previous rows.
+func (en *Enricher) Reload() error {
+	var errs []error
+	for _, l := range en.lookups {
+		if r, ok := l.table.(interface{ Reload() error }); ok {
+			if err := r.Reload(); err != nil {
+				errs = append(errs, fmt.Errorf("lookup %s: %w", l.cfg.Name, err))
+			}
+		}
+		l.cache.clear()
+	}
+	return errors.Join(errs...)
+}
+
+func (en *Enricher) Process(ctx context.Context, e pipeline.Event) (*pipeline.ProcessedEvent, error) {
+	start := time.Now()
+	out, err := en.apply(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	return &pipeline.ProcessedEvent{
+		Event:            out,
+		ProcessingTimeMS: time.Since(start).Milliseconds(),
+		ProcessedAt:      time.Now(),
+	}, nil
+}
+
+func (en *Enricher) Apply(ctx context.Context, e pipeline.Event) ([]pipeline.Event, error) {
+	out, err := en.apply(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	return []pipeline.Event{out}, nil
+}
+
+func (en *Enricher) apply(ctx context.Context, e pipeline.Event) (pipeline.Event, error) {
+	var data map[string]interface{}
+	for _, l := range en.lookups {
+		if !l.appliesTo(e.Type) {
+			continue
+		}
+		src := e.Data
+		if data != nil {
+			src = data
+		}
+		key, ok := lookupKey(e, src, l.cfg.Key)
+		if !ok {
+			continue
+		}
+
+		row, found, err := en.find(ctx, l, key)
+		if err != nil {
+			return e, fmt.Errorf("lookup %s: %w", l.cfg.Name, err)
+		}
+		if !found {
+			if l.cfg.Required {
+				return e, fmt.Errorf("lookup %s: no row for key %q", l.cfg.Name, key)
+			}
+			continue
+		}
+
+		if data == nil {
+			// Data may be shared with the WAL or a dead letter, never edit it in place
+			data, _ = deepCopy(e.Data).(map[string]interface{})
+			if data == nil {
+				data = map[string]interface{}{}
+			}
+		}
+		if err := l.merge(data, row); err != nil {
+			return e, fmt.Errorf("lookup %s: %w", l.cfg.Name, err)
+		}
+	}
+
+	if data != nil {
+		e.Data = data
+	}
+	return e, nil
+}
+
+func (en *Enricher) find(ctx context.Context, l *lookup, key string) (map[string]interface{}, bool, error) {
+	if row, found, ok := l.cache.get(key); ok {
+		en.observe(l.cfg.Name, true, found)
+		return row, found, nil
+	}
+
+	row, found, err := l.table.Lookup(ctx, key)
+	if err != nil {
+		if en.metrics != nil {
+			en.metrics.ObserveLookupError(l.cfg.Name)
+		}
+		return nil, false, err
+	}
+	l.cache.put(key, row, found)
+	en.observe(l.cfg.Name, false, found)
+	return row, found, nil
+}
+
+func (en *Enricher) observe(table string, cacheHit, found bool) {
+	if en.metrics != nil {
+		en.metrics.ObserveLookup(table, cacheHit, found)
+	}
+}
+
+func (l *lookup) appliesTo(eventType string) bool {
+	if len(l.cfg.Types) == 0 {
+		return true
+	}
+	for _, t := range l.cfg.Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// merge copies the configured fields of row into data at the target,
+// keeping fields data already has.
+func (l *lookup) merge(data, row map[string]interface{}) error {
+	fields := l.cfg.Fields
+	if len(fields) == 0 {
+		for f := range row {
+			fields = append(fields, f)
+		}
+	}
+	for _, f := range fields {
+		v, ok := row[f]
+		if !ok {
+			continue
+		}
+		path := f
+		if l.cfg.Target != "" {
+			path = l.cfg.Target + "." + f
+		}
+		if _, exists := getPath(data, path); exists {
+			continue
+		}
+		if err := setPath(data, path, deepCopy(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupKey reads key from e, with data standing in for e.Data. Empty and
+// missing values have no key.
+func lookupKey(e pipeline.Event, data map[string]interface{}, key string) (string, bool) {
+	var v interface{}
+	switch key {
+	case "id":
+		v = e.ID
+	case "type":
+		v = e.Type
+	case "source":
+		v = e.Source
+	case "user_id":
+		v = e.UserID
+	default:
+		v, _ = getPath(data, strings.TrimPrefix(key, "data."))
+	}
+	if v == nil {
+		return "", false
+	}
+	s := stringify(v)
+	return s, s != ""
+}
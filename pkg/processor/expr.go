@@ -0,0 +1,808 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"event-pipeline/internal/pipeline"
+)
+
+// ErrStepLimit is returned when an expression needs more evaluation steps
+// than its budget.
+var ErrStepLimit = errors.New("expression step limit exceeded")
+
+// DefaultMaxSteps bounds an evaluation when no limit is given.
+const DefaultMaxSteps = 10000
+
+// Expr is a compiled expression. The language has no loops, assignments
+// or I/O; it reads the event and returns a value:
+//
+//	data.temperature * 9 / 5 + 32
+//	type == "user_action" && lower(data.action) in ["click", "tap"]
+//	has(data.user.tier) ? data.user.tier : "free"
+//
+// Variables are id, type, source, user_id, timestamp (RFC 3339) and data;
+// missing fields read as null. Operators: ! - * / % + < <= > >= == != in
+// && || ?: with + also joining strings. Functions: len, lower, upper,
+// trim, contains, startsWith, endsWith, matches (literal pattern), has,
+// string, number, int, now (Unix seconds).
+type Expr struct {
+	src  string
+	root node
+}
+
+// CompileExpr parses src.
+func CompileExpr(src string) (*Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression against ev. It stops with ErrStepLimit
+// after maxSteps nodes (DefaultMaxSteps if maxSteps <= 0) and with the
+// context's error once ctx is done.
+func (e *Expr) Eval(ctx context.Context, ev pipeline.Event, maxSteps int) (interface{}, error) {
+	return e.eval(ctx, exprVars(ev), maxSteps)
+}
+
+func (e *Expr) eval(ctx context.Context, vars map[string]interface{}, maxSteps int) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxSteps
+	}
+	env := &evalEnv{ctx: ctx, vars: vars, maxSteps: maxSteps}
+	return e.root.eval(env)
+}
+
+// exprVars exposes ev to expressions. Data is copied, so nothing an
+// expression does can reach the event.
+func exprVars(ev pipeline.Event) map[string]interface{} {
+	var ts interface{}
+	if !ev.Timestamp.IsZero() {
+		ts = ev.Timestamp.UTC().Format(time.RFC3339Nano)
+	}
+	data, _ := deepCopy(ev.Data).(map[string]interface{})
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"id":        ev.ID,
+		"type":      ev.Type,
+		"source":    ev.Source,
+		"user_id":   ev.UserID,
+		"timestamp": ts,
+		"data":      data,
+	}
+}
+
+// --- lexer ---
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNum
+	tokStr
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	num  float64
+	pos  int
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.' || src[i] == 'e' || src[i] == 'E' ||
+				(src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E')) {
+				i++
+			}
+			f, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", src[start:i], start)
+			}
+			toks = append(toks, token{kind: tokNum, text: src[start:i], num: f, pos: start})
+
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(src) {
+					return nil, fmt.Errorf("unterminated string at %d", start)
+				}
+				if src[i] == c {
+					i++
+					break
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					default:
+						sb.WriteByte(src[i])
+					}
+					i++
+					continue
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			toks = append(toks, token{kind: tokStr, text: sb.String(), pos: start})
+
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || src[i] >= '0' && src[i] <= '9') {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, text: src[start:i], pos: start})
+
+		default:
+			op := ""
+			for _, cand := range []string{"&&", "||", "==", "!=", "<=", ">="} {
+				if strings.HasPrefix(src[i:], cand) {
+					op = cand
+					break
+				}
+			}
+			if op == "" {
+				if !strings.ContainsRune("!+-*/%<>()[].,?:", rune(c)) {
+					return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+				}
+				op = string(c)
+			}
+			toks = append(toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// --- parser ---
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokOp && !(t.kind == tokIdent && t.text == "in") {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.isOp(op) {
+		t := p.peek()
+		return fmt.Errorf("expected %q at %d, got %q", op, t.pos, t.text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parseExpr() (node, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("?") {
+		return cond, nil
+	}
+	p.next()
+	then, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	els, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &ternaryNode{cond: cond, then: then, els: els}, nil
+}
+
+// binary operators by precedence, loosest first
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">=", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) parseBinary(level int) (node, error) {
+	if level == len(precedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(precedence[level]...) {
+		op := p.next().text
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOp("!", "-") {
+		op := p.next().text
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.isOp("."):
+			p.next()
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name at %d", t.pos)
+			}
+			n = &indexNode{target: n, index: &literalNode{value: t.text}}
+		case p.isOp("["):
+			p.next()
+			idx, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = &indexNode{target: n, index: idx}
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNum:
+		return &literalNode{value: t.num}, nil
+	case tokStr:
+		return &literalNode{value: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if p.isOp("(") {
+			return p.parseCall(t)
+		}
+		switch t.text {
+		case "id", "type", "source", "user_id", "timestamp", "data":
+			return &varNode{name: t.text}, nil
+		}
+		return nil, fmt.Errorf("unknown variable %q at %d", t.text, t.pos)
+	case tokOp:
+		switch t.text {
+		case "(":
+			n, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			list := &listNode{}
+			for !p.isOp("]") {
+				item, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if !p.isOp(",") {
+					break
+				}
+				p.next()
+			}
+			return list, p.expect("]")
+		}
+	}
+	if t.kind == tokEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+// function name → number of arguments
+var builtins = map[string]int{
+	"len": 1, "lower": 1, "upper": 1, "trim": 1, "has": 1,
+	"string": 1, "number": 1, "int": 1,
+	"contains": 2, "startsWith": 2, "endsWith": 2, "matches": 2,
+	"now": 0,
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	arity, ok := builtins[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at %d", name.text, name.pos)
+	}
+	p.next() // (
+	call := &callNode{name: name.text}
+	for !p.isOp(")") {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if len(call.args) != arity {
+		return nil, fmt.Errorf("%s takes %d argument(s), got %d", name.text, arity, len(call.args))
+	}
+	if name.text == "matches" {
+		lit, ok := call.args[1].(*literalNode)
+		pattern, isStr := lit.valueString()
+		if !ok || !isStr {
+			return nil, fmt.Errorf("matches needs a literal pattern")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		call.re = re
+	}
+	return call, nil
+}
+
+// --- evaluation ---
+
+type evalEnv struct {
+	ctx      context.Context
+	vars     map[string]interface{}
+	steps    int
+	maxSteps int
+}
+
+// step charges one evaluation step and polls the context now and then.
+func (env *evalEnv) step() error {
+	env.steps++
+	if env.steps > env.maxSteps {
+		return ErrStepLimit
+	}
+	if env.steps%64 == 0 {
+		return env.ctx.Err()
+	}
+	return nil
+}
+
+type node interface {
+	eval(env *evalEnv) (interface{}, error)
+}
+
+type literalNode struct{ value interface{} }
+
+func (n *literalNode) eval(env *evalEnv) (interface{}, error) {
+	return n.value, env.step()
+}
+
+func (n *literalNode) valueString() (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	s, ok := n.value.(string)
+	return s, ok
+}
+
+type varNode struct{ name string }
+
+func (n *varNode) eval(env *evalEnv) (interface{}, error) {
+	return env.vars[n.name], env.step()
+}
+
+type listNode struct{ items []node }
+
+func (n *listNode) eval(env *evalEnv) (interface{}, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+type indexNode struct{ target, index node }
+
+func (n *indexNode) eval(env *evalEnv) (interface{}, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	target, err := n.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := n.index.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch t := target.(type) {
+	case map[string]interface{}:
+		key, ok := idx.(string)
+		if !ok {
+			return nil, fmt.Errorf("object key must be a string, got %s", typeName(idx))
+		}
+		return t[key], nil
+	case []interface{}:
+		f, ok := idx.(float64)
+		if !ok || f != math.Trunc(f) {
+			return nil, fmt.Errorf("list index must be an integer, got %v", idx)
+		}
+		if f < 0 || int(f) >= len(t) {
+			return nil, nil
+		}
+		return t[int(f)], nil
+	case nil:
+		// reading below a missing field is null, not an error
+		return nil, nil
+	}
+	return nil, fmt.Errorf("cannot index %s", typeName(target))
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(env *evalEnv) (interface{}, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("! needs a boolean, got %s", typeName(v))
+		}
+		return !b, nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("- needs a number, got %s", typeName(v))
+	}
+	return -f, nil
+}
+
+type ternaryNode struct{ cond, then, els node }
+
+func (n *ternaryNode) eval(env *evalEnv) (interface{}, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	c, err := n.cond.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := c.(bool)
+	if !ok {
+		return nil, fmt.Errorf("condition must be a boolean, got %s", typeName(c))
+	}
+	if b {
+		return n.then.eval(env)
+	}
+	return n.els.eval(env)
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(env *evalEnv) (interface{}, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// short-circuit
+	if n.op == "&&" || n.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs booleans, got %s", n.op, typeName(l))
+		}
+		if n.op == "&&" && !lb || n.op == "||" && lb {
+			return lb, nil
+		}
+		r, err := n.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs booleans, got %s", n.op, typeName(r))
+		}
+		return rb, nil
+	}
+
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(l, r), nil
+	case "!=":
+		return !reflect.DeepEqual(l, r), nil
+	case "in":
+		return evalIn(l, r)
+	case "+":
+		if ls, ok := l.(string); ok {
+			return ls + stringify(r), nil
+		}
+		if rs, ok := r.(string); ok {
+			return stringify(l) + rs, nil
+		}
+	case "<", "<=", ">", ">=":
+		if ls, ok := l.(string); ok {
+			if rs, ok := r.(string); ok {
+				return compare(n.op, strings.Compare(ls, rs)), nil
+			}
+		}
+	}
+
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("%s needs numbers, got %s and %s", n.op, typeName(l), typeName(r))
+	}
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(lf, rf), nil
+	case "<", "<=", ">", ">=":
+		c := 0
+		if lf < rf {
+			c = -1
+		} else if lf > rf {
+			c = 1
+		}
+		return compare(n.op, c), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+func compare(op string, c int) bool {
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func evalIn(needle, haystack interface{}) (interface{}, error) {
+	switch h := haystack.(type) {
+	case []interface{}:
+		for _, item := range h {
+			if reflect.DeepEqual(item, needle) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		key, ok := needle.(string)
+		if !ok {
+			return nil, fmt.Errorf("in object needs a string key, got %s", typeName(needle))
+		}
+		_, found := h[key]
+		return found, nil
+	case string:
+		s, ok := needle.(string)
+		if !ok {
+			return nil, fmt.Errorf("in string needs a string, got %s", typeName(needle))
+		}
+		return strings.Contains(h, s), nil
+	case nil:
+		return false, nil
+	}
+	return nil, fmt.Errorf("in needs a list, object or string, got %s", typeName(haystack))
+}
+
+type callNode struct {
+	name string
+	args []node
+	re   *regexp.Regexp
+}
+
+func (n *callNode) eval(env *evalEnv) (interface{}, error) {
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	switch n.name {
+	case "now":
+		return float64(time.Now().Unix()), nil
+	case "has":
+		return args[0] != nil, nil
+	case "string":
+		return stringify(args[0]), nil
+	case "number":
+		return coerce(args[0], "number")
+	case "int":
+		return coerce(args[0], "integer")
+	case "len":
+		switch v := args[0].(type) {
+		case string:
+			return float64(len([]rune(v))), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		case nil:
+			return float64(0), nil
+		}
+		return nil, fmt.Errorf("len needs a string, list or object, got %s", typeName(args[0]))
+	}
+
+	// the rest take strings; null reads as ""
+	strs := make([]string, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case string:
+			strs[i] = v
+		case nil:
+		default:
+			return nil, fmt.Errorf("%s needs strings, got %s", n.name, typeName(a))
+		}
+	}
+	switch n.name {
+	case "lower":
+		return strings.ToLower(strs[0]), nil
+	case "upper":
+		return strings.ToUpper(strs[0]), nil
+	case "trim":
+		return strings.TrimSpace(strs[0]), nil
+	case "contains":
+		return strings.Contains(strs[0], strs[1]), nil
+	case "startsWith":
+		return strings.HasPrefix(strs[0], strs[1]), nil
+	case "endsWith":
+		return strings.HasSuffix(strs[0], strs[1]), nil
+	case "matches":
+		return n.re.MatchString(strs[0]), nil
+	}
+	return nil, fmt.Errorf("unknown function %s", n.name)
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
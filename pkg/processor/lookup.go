@@ -0,0 +1,287 @@
+package processor
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LookupTable maps a key to a row of reference data.
+type LookupTable interface {
+	// Lookup returns the row for key, or false if there is none.
+	Lookup(ctx context.Context, key string) (map[string]interface{}, bool, error)
+}
+
+// FileTable is a lookup table held in memory, read from a CSV file with a
+// header row or a JSON file. A JSON file is either an object of rows keyed
+// by the lookup key, or an array of rows carrying the key in keyColumn.
+type FileTable struct {
+	path      string
+	keyColumn string
+
+	mu   sync.RWMutex
+	rows map[string]map[string]interface{}
+}
+
+// LoadFileTable reads path. keyColumn names the key column of CSV files
+// and JSON arrays; for CSV it defaults to the first column.
+func LoadFileTable(path, keyColumn string) (*FileTable, error) {
+	t := &FileTable{path: path, keyColumn: keyColumn}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reload re-reads the file. On error the previous rows are kept.
+func (t *FileTable) Reload() error {
+	raw, err := os.ReadFile(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to read lookup table: %w", err)
+	}
+
+	var rows map[string]map[string]interface{}
+	switch strings.ToLower(filepath.Ext(t.path)) {
+	case ".csv":
+		rows, err = parseCSVTable(raw, t.keyColumn)
+	case ".json":
+		rows, err = parseJSONTable(raw, t.keyColumn)
+	default:
+		err = fmt.Errorf("unsupported lookup table format %q", filepath.Ext(t.path))
+	}
+	if err != nil {
+		return fmt.Errorf("lookup table %s: %w", t.path, err)
+	}
+
+	t.mu.Lock()
+	t.rows = rows
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *FileTable) Lookup(ctx context.Context, key string) (map[string]interface{}, bool, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	row, ok := t.rows[key]
+	return row, ok, nil
+}
+
+// Len is the number of rows in the table.
+func (t *FileTable) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.rows)
+}
+
+func parseCSVTable(raw []byte, keyColumn string) (map[string]map[string]interface{}, error) {
+	records, err := csv.NewReader(strings.NewReader(string(raw))).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("missing header row")
+	}
+
+	header := records[0]
+	keyIdx := 0
+	if keyColumn != "" {
+		keyIdx = -1
+		for i, h := range header {
+			if h == keyColumn {
+				keyIdx = i
+			}
+		}
+		if keyIdx < 0 {
+			return nil, fmt.Errorf("no column %q", keyColumn)
+		}
+	}
+
+	rows := make(map[string]map[string]interface{}, len(records)-1)
+	for _, rec := range records[1:] {
+		row := make(map[string]interface{}, len(header)-1)
+		for i, h := range header {
+			if i != keyIdx {
+				row[h] = rec[i]
+			}
+		}
+		rows[rec[keyIdx]] = row
+	}
+	return rows, nil
+}
+
+func parseJSONTable(raw []byte, keyColumn string) (map[string]map[string]interface{}, error) {
+	var keyed map[string]map[string]interface{}
+	if err := json.Unmarshal(raw, &keyed); err == nil {
+		return keyed, nil
+	}
+
+	var list []map[string]interface{}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("want an object of rows or an array of rows: %w", err)
+	}
+	if keyColumn == "" {
+		return nil, fmt.Errorf("an array of rows needs key_column")
+	}
+	rows := make(map[string]map[string]interface{}, len(list))
+	for i, row := range list {
+		k, ok := row[keyColumn]
+		if !ok || k == nil {
+			return nil, fmt.Errorf("row %d has no %q", i, keyColumn)
+		}
+		delete(row, keyColumn)
+		rows[stringify(k)] = row
+	}
+	return rows, nil
+}
+
+var sqlIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SQLTable looks rows up in a MySQL table, one query per key.
+type SQLTable struct {
+	db    *sql.DB
+	query string
+}
+
+// NewSQLTable looks keys up in table.keyColumn, returning columns (all of
+// them if empty). Names are checked, since they cannot be query parameters.
+func NewSQLTable(db *sql.DB, table, keyColumn string, columns []string) (*SQLTable, error) {
+	if db == nil {
+		return nil, fmt.Errorf("table lookups need a database")
+	}
+	for _, name := range append([]string{table, keyColumn}, columns...) {
+		if !sqlIdent.MatchString(name) {
+			return nil, fmt.Errorf("invalid table or column name %q", name)
+		}
+	}
+
+	cols := "*"
+	if len(columns) > 0 {
+		cols = "`" + strings.Join(columns, "`, `") + "`"
+	}
+	return &SQLTable{
+		db:    db,
+		query: fmt.Sprintf("SELECT %s FROM `%s` WHERE `%s` = ? LIMIT 1", cols, table, keyColumn),
+	}, nil
+}
+
+func (t *SQLTable) Lookup(ctx context.Context, key string) (map[string]interface{}, bool, error) {
+	rows, err := t.db.QueryContext(ctx, t.query, key)
+	if err != nil {
+		return nil, false, fmt.Errorf("lookup query failed: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, false, rows.Err()
+	}
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, false, err
+	}
+	values := make([]interface{}, len(names))
+	ptrs := make([]interface{}, len(names))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, false, fmt.Errorf("lookup scan failed: %w", err)
+	}
+
+	row := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		switch v := values[i].(type) {
+		case []byte:
+			row[name] = string(v)
+		case int64:
+			row[name] = float64(v)
+		case time.Time:
+			row[name] = v.UTC().Format(time.RFC3339Nano)
+		default:
+			row[name] = v
+		}
+	}
+	return row, true, rows.Err()
+}
+
+// lookupCache remembers lookup results, including missing keys, for a
+// fixed TTL, holding at most maxKeys of them. Like pipeline.DedupCache,
+// entries expire in insertion order.
+type lookupCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxKeys int
+	order   *list.List // of *cacheEntry, oldest first
+	keys    map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	row     map[string]interface{}
+	found   bool
+	expires time.Time
+}
+
+func newLookupCache(ttl time.Duration, maxKeys int) *lookupCache {
+	return &lookupCache{
+		ttl:     ttl,
+		maxKeys: maxKeys,
+		order:   list.New(),
+		keys:    make(map[string]*list.Element),
+	}
+}
+
+func (c *lookupCache) get(key string) (row map[string]interface{}, found, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evictExpired(time.Now())
+	el, ok := c.keys[key]
+	if !ok {
+		return nil, false, false
+	}
+	e := el.Value.(*cacheEntry)
+	return e.row, e.found, true
+}
+
+func (c *lookupCache) put(key string, row map[string]interface{}, found bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.keys[key]; ok {
+		c.remove(el)
+	}
+	if c.maxKeys > 0 && c.order.Len() >= c.maxKeys {
+		c.remove(c.order.Front())
+	}
+	c.keys[key] = c.order.PushBack(&cacheEntry{key: key, row: row, found: found, expires: time.Now().Add(c.ttl)})
+}
+
+func (c *lookupCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.keys = make(map[string]*list.Element)
+}
+
+func (c *lookupCache) evictExpired(now time.Time) {
+	for el := c.order.Front(); el != nil; el = c.order.Front() {
+		if el.Value.(*cacheEntry).expires.After(now) {
+			return
+		}
+		c.remove(el)
+	}
+}
+
+func (c *lookupCache) remove(el *list.Element) {
+	delete(c.keys, el.Value.(*cacheEntry).key)
+	c.order.Remove(el)
+}
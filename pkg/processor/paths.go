@@ -0,0 +1,83 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// getPath resolves a dotted path in data.
+func getPath(data map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = data
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// setPath stores v at a dotted path, creating missing parent objects.
+func setPath(data map[string]interface{}, path string, v interface{}) error {
+	parts := strings.Split(path, ".")
+	obj := data
+	for i, part := range parts[:len(parts)-1] {
+		next, ok := obj[part]
+		if !ok {
+			child := map[string]interface{}{}
+			obj[part] = child
+			obj = child
+			continue
+		}
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an object", strings.Join(parts[:i+1], "."))
+		}
+		obj = child
+	}
+	obj[parts[len(parts)-1]] = v
+	return nil
+}
+
+// deletePath removes a dotted path and returns the value it held.
+func deletePath(data map[string]interface{}, path string) (interface{}, bool) {
+	parentPath, name := splitParent(path)
+	parent := data
+	if parentPath != "" {
+		p, ok := getPath(data, parentPath)
+		if !ok {
+			return nil, false
+		}
+		if parent, ok = p.(map[string]interface{}); !ok {
+			return nil, false
+		}
+	}
+	v, ok := parent[name]
+	delete(parent, name)
+	return v, ok
+}
+
+func splitParent(path string) (parent, name string) {
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return "", path
+}
+
+// deepCopy copies a payload through JSON, which also turns Go values
+// built in code (ints, typed maps) into the shapes a decoded request has.
+func deepCopy(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
@@ -0,0 +1,197 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"event-pipeline/internal/pipeline"
+)
+
+// ScriptConfig is the file read by LoadScripts:
+//
+//	{
+//	  "timeout_ms": 5,
+//	  "max_steps": 10000,
+//	  "on_error": "skip",
+//	  "scripts": {
+//	    "sensor_data": {
+//	      "filter": "data.temperature > -100",
+//	      "set": [
+//	        {"field": "temperature_f", "expr": "data.temperature * 9 / 5 + 32"},
+//	        {"field": "route", "expr": "data.temperature > 80 ? 'alerts' : 'default'"}
+//	      ]
+//	    }
+//	  }
+//	}
+//
+// Scripts under "*" run for every event, before the one for its type. An
+// event whose filter is false is dropped; set assigns Data fields in
+// order, each seeing the fields set before it.
+type ScriptConfig struct {
+	TimeoutMS int                     `json:"timeout_ms,omitempty"`
+	MaxSteps  int                     `json:"max_steps,omitempty"`
+	OnError   pipeline.ErrorPolicy    `json:"on_error,omitempty"`
+	Scripts   map[string]ScriptSource `json:"scripts"`
+}
+
+// ScriptSource is the script for one event type.
+type ScriptSource struct {
+	Filter string       `json:"filter,omitempty"`
+	Set    []Assignment `json:"set,omitempty"`
+}
+
+// Assignment sets a Data field to the value of an expression.
+type Assignment struct {
+	Field string `json:"field"`
+	Expr  string `json:"expr"`
+}
+
+type compiledScript struct {
+	filter *Expr
+	set    []compiledAssignment
+}
+
+type compiledAssignment struct {
+	field string
+	expr  *Expr
+}
+
+// Scripts evaluates per-type expression scripts. It is both a Processor
+// and a pipeline.Stage. Every event gets at most TimeoutMS of evaluation,
+// enforced through the context, and each expression at most MaxSteps.
+type Scripts struct {
+	timeout  time.Duration
+	maxSteps int
+	onError  pipeline.ErrorPolicy
+	scripts  map[string]compiledScript
+}
+
+// LoadScripts reads and compiles a script config from path.
+func LoadScripts(path string) (*Scripts, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scripts: %w", err)
+	}
+	return ParseScripts(raw)
+}
+
+// ParseScripts decodes and compiles a script config.
+func ParseScripts(data []byte) (*Scripts, error) {
+	var cfg ScriptConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid script config: %w", err)
+	}
+	return NewScripts(cfg)
+}
+
+// NewScripts compiles cfg.
+func NewScripts(cfg ScriptConfig) (*Scripts, error) {
+	if err := checkPolicy(cfg.OnError); err != nil {
+		return nil, err
+	}
+
+	s := &Scripts{
+		timeout:  time.Duration(cfg.TimeoutMS) * time.Millisecond,
+		maxSteps: cfg.MaxSteps,
+		onError:  cfg.OnError,
+		scripts:  make(map[string]compiledScript, len(cfg.Scripts)),
+	}
+	for t, src := range cfg.Scripts {
+		var cs compiledScript
+		if strings.TrimSpace(src.Filter) != "" {
+			e, err := CompileExpr(src.Filter)
+			if err != nil {
+				return nil, fmt.Errorf("script %s: filter: %w", t, err)
+			}
+			cs.filter = e
+		}
+		for i, a := range src.Set {
+			if a.Field == "" {
+				return nil, fmt.Errorf("script %s: set[%d]: missing field", t, i)
+			}
+			e, err := CompileExpr(a.Expr)
+			if err != nil {
+				return nil, fmt.Errorf("script %s: set %s: %w", t, a.Field, err)
+			}
+			cs.set = append(cs.set, compiledAssignment{field: a.Field, expr: e})
+		}
+		s.scripts[t] = cs
+	}
+	return s, nil
+}
+
+// OnError is the error policy the config asks for.
+func (s *Scripts) OnError() pipeline.ErrorPolicy {
+	return s.onError
+}
+
+func (s *Scripts) Process(ctx context.Context, e pipeline.Event) (*pipeline.ProcessedEvent, error) {
+	start := time.Now()
+	out, err := s.Apply(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, pipeline.ErrEventDropped
+	}
+	return &pipeline.ProcessedEvent{
+		Event:            out[0],
+		ProcessingTimeMS: time.Since(start).Milliseconds(),
+		ProcessedAt:      time.Now(),
+	}, nil
+}
+
+func (s *Scripts) Apply(ctx context.Context, e pipeline.Event) ([]pipeline.Event, error) {
+	var run []compiledScript
+	for _, t := range []string{"*", e.Type} {
+		if cs, ok := s.scripts[t]; ok {
+			run = append(run, cs)
+		}
+	}
+	if len(run) == 0 {
+		return []pipeline.Event{e}, nil
+	}
+
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	vars := exprVars(e)
+	data := vars["data"].(map[string]interface{})
+	for _, cs := range run {
+		if cs.filter != nil {
+			v, err := cs.filter.eval(ctx, vars, s.maxSteps)
+			if err != nil {
+				return nil, fmt.Errorf("filter %q: %w", cs.filter, err)
+			}
+			keep, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("filter %q returned %s, not a boolean", cs.filter, typeName(v))
+			}
+			if !keep {
+				return nil, nil
+			}
+		}
+		for _, a := range cs.set {
+			v, err := a.expr.eval(ctx, vars, s.maxSteps)
+			if err != nil {
+				return nil, fmt.Errorf("set %s: %w", a.field, err)
+			}
+			if err := setPath(data, a.field, v); err != nil {
+				return nil, fmt.Errorf("set %s: %w", a.field, err)
+			}
+		}
+	}
+
+	e.Data = data
+	return []pipeline.Event{e}, nil
+}
@@ -0,0 +1,438 @@
+// Package processor holds built-in processing stages that plug into a
+// pipeline.ProcessorChain.
+package processor
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"event-pipeline/internal/pipeline"
+)
+
+// Transform operations.
+const (
+	OpRename  = "rename"
+	OpCopy    = "copy"
+	OpDelete  = "delete"
+	OpSet     = "set"
+	OpCoerce  = "coerce"
+	OpFlatten = "flatten"
+	OpHash    = "hash"
+	OpMask    = "mask"
+)
+
+// TransformConfig is the file read by LoadTransform:
+//
+//	{
+//	  "on_error": "dead_letter",
+//	  "transforms": {
+//	    "*":           [{"op": "delete", "field": "debug"}],
+//	    "user_action": [
+//	      {"op": "rename", "from": "user.mail", "to": "email"},
+//	      {"op": "hash", "field": "email", "salt": "s3cret"},
+//	      {"op": "mask", "field": "ip"}
+//	    ],
+//	    "sensor_data": [
+//	      {"op": "coerce", "field": "temperature", "to": "number"},
+//	      {"op": "coerce", "field": "measured_at", "to": "rfc3339"},
+//	      {"op": "flatten", "field": "device", "separator": "_"}
+//	    ]
+//	  }
+//	}
+//
+// Operations under "*" run for every event, before the ones for its
+// type. Fields are keys of Data; dots reach into nested objects.
+type TransformConfig struct {
+	OnError    pipeline.ErrorPolicy   `json:"on_error,omitempty"`
+	Transforms map[string][]Operation `json:"transforms"`
+}
+
+// Operation is one step of a transform.
+type Operation struct {
+	Op    string      `json:"op"`
+	Field string      `json:"field,omitempty"`
+	From  string      `json:"from,omitempty"`
+	To    string      `json:"to,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+	// Separator joins flattened keys, "." by default.
+	Separator string `json:"separator,omitempty"`
+	// Salt is prepended to the value before hashing.
+	Salt string `json:"salt,omitempty"`
+	// KeepLast is how many trailing characters mask leaves for values
+	// that are neither emails nor IPs, 4 by default.
+	KeepLast *int `json:"keep_last,omitempty"`
+}
+
+// Transform rewrites Event.Data declaratively. It is both a Processor
+// and a pipeline.Stage.
+type Transform struct {
+	cfg TransformConfig
+}
+
+// LoadTransform reads a transform config from path.
+func LoadTransform(path string) (*Transform, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transform config: %w", err)
+	}
+	return ParseTransform(raw)
+}
+
+// ParseTransform decodes and checks a transform config.
+func ParseTransform(data []byte) (*Transform, error) {
+	var cfg TransformConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid transform config: %w", err)
+	}
+	if err := checkPolicy(cfg.OnError); err != nil {
+		return nil, err
+	}
+	for t, ops := range cfg.Transforms {
+		for i, op := range ops {
+			if err := op.check(); err != nil {
+				return nil, fmt.Errorf("transform %s[%d]: %w", t, i, err)
+			}
+		}
+	}
+	return &Transform{cfg: cfg}, nil
+}
+
+// NewTransform builds a transform from an in-memory config.
+func NewTransform(cfg TransformConfig) (*Transform, error) {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTransform(raw)
+}
+
+// OnError is the error policy the config asks for.
+func (t *Transform) OnError() pipeline.ErrorPolicy {
+	return t.cfg.OnError
+}
+
+func (op Operation) check() error {
+	switch op.Op {
+	case OpRename, OpCopy:
+		if op.From == "" || op.To == "" {
+			return fmt.Errorf("%s needs from and to", op.Op)
+		}
+	case OpDelete, OpSet, OpHash, OpMask:
+		if op.Field == "" {
+			return fmt.Errorf("%s needs a field", op.Op)
+		}
+	case OpCoerce:
+		if op.Field == "" {
+			return fmt.Errorf("coerce needs a field")
+		}
+		switch op.To {
+		case "number", "integer", "string", "boolean", "rfc3339":
+		default:
+			return fmt.Errorf("coerce to %q is not supported", op.To)
+		}
+	case OpFlatten:
+		// an empty field flattens the whole payload
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+	return nil
+}
+
+func (t *Transform) Process(ctx context.Context, e pipeline.Event) (*pipeline.ProcessedEvent, error) {
+	start := time.Now()
+	out, err := t.apply(e)
+	if err != nil {
+		return nil, err
+	}
+	return &pipeline.ProcessedEvent{
+		Event:            out,
+		ProcessingTimeMS: time.Since(start).Milliseconds(),
+		ProcessedAt:      time.Now(),
+	}, nil
+}
+
+// Apply returns the transformed event even when an operation failed, so
+// a chain that skips the error still stores the redacted payload.
+func (t *Transform) Apply(ctx context.Context, e pipeline.Event) ([]pipeline.Event, error) {
+	out, err := t.apply(e)
+	return []pipeline.Event{out}, err
+}
+
+// apply runs the operations for e's type one by one. A failing operation
+// leaves its field as it was and the rest still run, so one bad field
+// cannot keep hash and mask from redacting the others; a value hash or
+// mask fails on is deleted rather than passed on. The first error is
+// returned along with the event.
+func (t *Transform) apply(e pipeline.Event) (pipeline.Event, error) {
+	ops := append(append([]Operation(nil), t.cfg.Transforms["*"]...), t.cfg.Transforms[e.Type]...)
+	if len(ops) == 0 {
+		return e, nil
+	}
+
+	// Data may be shared with the WAL or a dead letter, never edit it in place
+	data, _ := deepCopy(e.Data).(map[string]interface{})
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	var firstErr error
+	for _, op := range ops {
+		err := op.apply(data)
+		if err == nil {
+			continue
+		}
+		if op.Op == OpHash || op.Op == OpMask {
+			deletePath(data, op.Field)
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%s %s: %w", op.Op, op.target(), err)
+		}
+	}
+	e.Data = data
+	return e, firstErr
+}
+
+func (op Operation) target() string {
+	if op.Field != "" {
+		return op.Field
+	}
+	return op.From
+}
+
+func (op Operation) apply(data map[string]interface{}) error {
+	switch op.Op {
+	case OpRename:
+		if v, ok := deletePath(data, op.From); ok {
+			if err := setPath(data, op.To, v); err != nil {
+				_ = setPath(data, op.From, v)
+				return err
+			}
+		}
+	case OpCopy:
+		if v, ok := getPath(data, op.From); ok {
+			return setPath(data, op.To, deepCopy(v))
+		}
+	case OpDelete:
+		deletePath(data, op.Field)
+	case OpSet:
+		return setPath(data, op.Field, deepCopy(op.Value))
+	case OpCoerce:
+		v, ok := getPath(data, op.Field)
+		if !ok || v == nil {
+			return nil
+		}
+		c, err := coerce(v, op.To)
+		if err != nil {
+			return err
+		}
+		return setPath(data, op.Field, c)
+	case OpFlatten:
+		return flatten(data, op.Field, op.separator())
+	case OpHash:
+		if v, ok := getPath(data, op.Field); ok && v != nil {
+			sum := sha256.Sum256([]byte(op.Salt + stringify(v)))
+			return setPath(data, op.Field, hex.EncodeToString(sum[:]))
+		}
+	case OpMask:
+		if v, ok := getPath(data, op.Field); ok && v != nil {
+			keep := 4
+			if op.KeepLast != nil {
+				keep = *op.KeepLast
+			}
+			return setPath(data, op.Field, mask(stringify(v), keep))
+		}
+	}
+	return nil
+}
+
+func (op Operation) separator() string {
+	if op.Separator == "" {
+		return "."
+	}
+	return op.Separator
+}
+
+func coerce(v interface{}, to string) (interface{}, error) {
+	switch to {
+	case "string":
+		return stringify(v), nil
+	case "number", "integer":
+		var f float64
+		switch val := v.(type) {
+		case float64:
+			f = val
+		case bool:
+			if val {
+				f = 1
+			}
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a number", val)
+			}
+			f = parsed
+		default:
+			return nil, fmt.Errorf("cannot convert %T to a number", v)
+		}
+		if to == "integer" {
+			return math.Trunc(f), nil
+		}
+		return f, nil
+	case "boolean":
+		switch val := v.(type) {
+		case bool:
+			return val, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(val))
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a boolean", val)
+			}
+			return b, nil
+		case float64:
+			return val != 0, nil
+		}
+		return nil, fmt.Errorf("cannot convert %T to a boolean", v)
+	case "rfc3339":
+		return epochToRFC3339(v)
+	}
+	return nil, fmt.Errorf("unsupported coercion %q", to)
+}
+
+// epochToRFC3339 converts Unix seconds, or milliseconds for values too
+// large to be seconds, to an RFC 3339 UTC timestamp. RFC 3339 strings are
+// normalised to UTC.
+func epochToRFC3339(v interface{}) (interface{}, error) {
+	var f float64
+	switch val := v.(type) {
+	case float64:
+		f = val
+	case string:
+		if ts, err := time.Parse(time.RFC3339Nano, val); err == nil {
+			return ts.UTC().Format(time.RFC3339Nano), nil
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an epoch timestamp", val)
+		}
+		f = parsed
+	default:
+		return nil, fmt.Errorf("cannot convert %T to a timestamp", v)
+	}
+
+	// 1e11 seconds is the year 5138, anything above is milliseconds
+	var ts time.Time
+	if math.Abs(f) >= 1e11 {
+		ts = time.UnixMilli(int64(f))
+	} else {
+		sec, frac := math.Modf(f)
+		ts = time.Unix(int64(sec), int64(frac*1e9))
+	}
+	return ts.UTC().Format(time.RFC3339Nano), nil
+}
+
+// flatten replaces the object at field (or the whole payload) with its
+// leaves, keyed by their joined paths.
+func flatten(data map[string]interface{}, field, sep string) error {
+	if field == "" {
+		flat := map[string]interface{}{}
+		flattenInto(flat, "", sep, data)
+		for k := range data {
+			delete(data, k)
+		}
+		for k, v := range flat {
+			data[k] = v
+		}
+		return nil
+	}
+
+	v, ok := getPath(data, field)
+	if !ok {
+		return nil
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	deletePath(data, field)
+	parentPath, name := splitParent(field)
+	parent := data
+	if parentPath != "" {
+		p, _ := getPath(data, parentPath)
+		parent, _ = p.(map[string]interface{})
+	}
+	flattenInto(parent, name, sep, obj)
+	return nil
+}
+
+func flattenInto(dst map[string]interface{}, prefix, sep string, v interface{}) {
+	obj, ok := v.(map[string]interface{})
+	if !ok || len(obj) == 0 {
+		dst[prefix] = v
+		return
+	}
+	for k, child := range obj {
+		key := k
+		if prefix != "" {
+			key = prefix + sep + k
+		}
+		flattenInto(dst, key, sep, child)
+	}
+}
+
+// mask hides most of a value: the local part of an email, the host part
+// of an IP (last octet for IPv4, last 80 bits for IPv6), or all but the
+// last keep characters of anything else.
+func mask(s string, keep int) string {
+	if at := strings.LastIndex(s, "@"); at > 0 {
+		return s[:1] + "***" + s[at:]
+	}
+	if ip := net.ParseIP(s); ip != nil {
+		if v4 := ip.To4(); v4 != nil && strings.Contains(s, ".") {
+			return net.IPv4(v4[0], v4[1], v4[2], 0).String()
+		}
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	}
+
+	r := []rune(s)
+	if keep < 0 {
+		keep = 0
+	}
+	if keep >= len(r) {
+		return strings.Repeat("*", len(r))
+	}
+	return strings.Repeat("*", len(r)-keep) + string(r[len(r)-keep:])
+}
+
+func stringify(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	if b, err := json.Marshal(v); err == nil {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+func checkPolicy(p pipeline.ErrorPolicy) error {
+	switch p {
+	case "", pipeline.PolicyDeadLetter, pipeline.PolicyFail, pipeline.PolicySkip:
+		return nil
+	}
+	return fmt.Errorf("unknown error policy %q", p)
+}
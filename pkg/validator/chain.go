@@ -0,0 +1,35 @@
+package validator
+
+import (
+	"context"
+
+	"event-pipeline/internal/pipeline"
+)
+
+// Chain runs several validators on every event and reports the field
+// errors of all of them together.
+type Chain struct {
+	validators []pipeline.Validator
+}
+
+// NewChain composes validators, run in the given order. Nil entries are
+// skipped so optional validators can be passed unconditionally.
+func NewChain(validators ...pipeline.Validator) *Chain {
+	c := &Chain{}
+	for _, v := range validators {
+		if v != nil {
+			c.validators = append(c.validators, v)
+		}
+	}
+	return c
+}
+
+func (c *Chain) Validate(ctx context.Context, e pipeline.Event) error {
+	verr := &pipeline.ValidationError{}
+	for _, v := range c.validators {
+		if err := v.Validate(ctx, e); err != nil {
+			verr.Fields = append(verr.Fields, fieldsOf(err)...)
+		}
+	}
+	return verr.ErrOrNil()
+}
@@ -0,0 +1,196 @@
+package validator
+
+import (
+	"fmt"
+	"sort"
+)
+
+// checkCompatibility returns why next cannot replace prev under mode, or
+// nothing when it can.
+func checkCompatibility(mode string, next, prev *Schema) []string {
+	var reasons []string
+	switch mode {
+	case CompatBackward:
+		accepts(next, prev, "", &reasons)
+	case CompatForward:
+		accepts(prev, next, "", &reasons)
+	case CompatFull:
+		accepts(next, prev, "", &reasons)
+		accepts(prev, next, "", &reasons)
+	}
+	return reasons
+}
+
+// accepts records in reasons every way a payload valid under b could be
+// rejected by a. The check is conservative: a constraint it cannot prove
+// looser counts as tighter. The one exception is adding an optional
+// property, which is how schemas normally evolve.
+func accepts(a, b *Schema, path string, reasons *[]string) {
+	at := pointerOrRoot(path)
+	fail := func(format string, args ...interface{}) {
+		*reasons = append(*reasons, at+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(a.Types) > 0 {
+		if len(b.Types) == 0 {
+			fail("type narrowed to %v", a.Types)
+		} else {
+			for _, t := range b.Types {
+				if !typeAllowed(a.Types, t) {
+					fail("type %s no longer allowed", t)
+				}
+			}
+		}
+	}
+
+	if len(a.Enum) > 0 {
+		if len(b.Enum) == 0 {
+			fail("enum added")
+		} else {
+			for _, v := range b.Enum {
+				if !containsJSON(a.Enum, v) {
+					fail("enum value %v removed", v)
+				}
+			}
+		}
+	}
+	if a.Const != nil && (b.Const == nil || !equalJSON(a.Const, b.Const)) {
+		fail("const changed")
+	}
+
+	for _, name := range a.Required {
+		if !containsString(b.Required, name) {
+			fail("property %q became required", name)
+		}
+	}
+
+	for _, name := range sortedKeys(a.Properties) {
+		ap := a.Properties[name]
+		child := path + "/" + escapePointer(name)
+		// a property b did not declare is treated as new rather than as a
+		// constraint on unchecked data, so optional fields can be added
+		if bp, ok := b.Properties[name]; ok {
+			accepts(ap, bp, child, reasons)
+		}
+	}
+	if closed(a) {
+		if !closed(b) {
+			fail("additional properties no longer allowed")
+		}
+		for _, name := range sortedKeys(b.Properties) {
+			if _, ok := a.Properties[name]; !ok {
+				fail("property %q removed from a closed object", name)
+			}
+		}
+	}
+
+	if a.Items != nil {
+		if b.Items == nil {
+			if constrained(a.Items) {
+				fail("item constraints added")
+			}
+		} else {
+			accepts(a.Items, b.Items, path+"/items", reasons)
+		}
+	}
+
+	if lowerTightened(a.Minimum, b.Minimum) {
+		fail("minimum raised")
+	}
+	if lowerTightened(a.ExclusiveMinimum, b.ExclusiveMinimum) {
+		fail("exclusiveMinimum raised")
+	}
+	if upperTightened(a.Maximum, b.Maximum) {
+		fail("maximum lowered")
+	}
+	if upperTightened(a.ExclusiveMaximum, b.ExclusiveMaximum) {
+		fail("exclusiveMaximum lowered")
+	}
+	if lowerTightened(intBound(a.MinLength), intBound(b.MinLength)) {
+		fail("minLength raised")
+	}
+	if upperTightened(intBound(a.MaxLength), intBound(b.MaxLength)) {
+		fail("maxLength lowered")
+	}
+	if lowerTightened(intBound(a.MinItems), intBound(b.MinItems)) {
+		fail("minItems raised")
+	}
+	if upperTightened(intBound(a.MaxItems), intBound(b.MaxItems)) {
+		fail("maxItems lowered")
+	}
+
+	if a.Pattern != "" && a.Pattern != b.Pattern {
+		fail("pattern changed to %q", a.Pattern)
+	}
+	if a.Format != "" && a.Format != b.Format {
+		fail("format changed to %q", a.Format)
+	}
+}
+
+// typeAllowed reports whether a value of type t passes a type list.
+func typeAllowed(types []string, t string) bool {
+	for _, allowed := range types {
+		if allowed == t || allowed == "number" && t == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func closed(s *Schema) bool {
+	return s.AdditionalProperties != nil && !*s.AdditionalProperties
+}
+
+// constrained reports whether s rejects anything at all.
+func constrained(s *Schema) bool {
+	return len(s.Types) > 0 || len(s.Enum) > 0 || s.Const != nil ||
+		len(s.Properties) > 0 || len(s.Required) > 0 || closed(s) || s.Items != nil ||
+		s.Minimum != nil || s.Maximum != nil || s.ExclusiveMinimum != nil || s.ExclusiveMaximum != nil ||
+		s.MinLength != nil || s.MaxLength != nil || s.MinItems != nil || s.MaxItems != nil ||
+		s.Pattern != "" || s.Format != ""
+}
+
+// lowerTightened reports whether lower bound a rejects values bound b allowed.
+func lowerTightened(a, b *float64) bool {
+	return a != nil && (b == nil || *a > *b)
+}
+
+// upperTightened reports whether upper bound a rejects values bound b allowed.
+func upperTightened(a, b *float64) bool {
+	return a != nil && (b == nil || *a < *b)
+}
+
+func intBound(n *int) *float64 {
+	if n == nil {
+		return nil
+	}
+	f := float64(*n)
+	return &f
+}
+
+func containsJSON(values []interface{}, v interface{}) bool {
+	for _, e := range values {
+		if equalJSON(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,341 @@
+package validator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"event-pipeline/pkg/logger"
+)
+
+// Compatibility modes checked when a new schema version is registered.
+const (
+	CompatNone     = "none"
+	CompatBackward = "backward" // the new version accepts everything the previous one did
+	CompatForward  = "forward"  // the previous version accepts everything the new one does
+	CompatFull     = "full"     // both
+)
+
+var (
+	// ErrSchemaNotFound is returned for an unknown type or version.
+	ErrSchemaNotFound = errors.New("schema not found")
+	// ErrIncompatibleSchema is wrapped by CompatibilityError.
+	ErrIncompatibleSchema = errors.New("incompatible schema")
+)
+
+// CompatibilityError lists why a schema was refused on registration.
+type CompatibilityError struct {
+	Mode    string
+	Reasons []string
+}
+
+func (e *CompatibilityError) Error() string {
+	return fmt.Sprintf("schema is not %s compatible: %s", e.Mode, strings.Join(e.Reasons, "; "))
+}
+
+func (e *CompatibilityError) Unwrap() error {
+	return ErrIncompatibleSchema
+}
+
+// SchemaVersion is one registered version of an event type's schema.
+type SchemaVersion struct {
+	Type      string          `json:"type"`
+	Version   int             `json:"version"`
+	Schema    json.RawMessage `json:"schema"`
+	CreatedAt time.Time       `json:"created_at"`
+
+	compiled *Schema
+}
+
+// Registry keeps versioned schemas per event type on disk. Versions live
+// in <dir>/<type>/<version>.json; a flat <dir>/<type>.json is read as
+// version 1 of that type.
+type Registry struct {
+	dir           string
+	defaultCompat string
+
+	mu       sync.RWMutex
+	versions map[string][]*SchemaVersion // ordered by version
+}
+
+// NewRegistry loads the registry from dir. defaultCompat is the mode
+// applied when a registration does not name one.
+func NewRegistry(dir, defaultCompat string) (*Registry, error) {
+	if defaultCompat == "" {
+		defaultCompat = CompatBackward
+	}
+	if err := checkCompatMode(defaultCompat); err != nil {
+		return nil, err
+	}
+
+	r := &Registry{dir: dir, defaultCompat: defaultCompat}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the registry directory. On error the loaded versions
+// are left untouched.
+func (r *Registry) Reload() error {
+	versions, err := loadRegistryDir(r.dir)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.versions = versions
+	r.mu.Unlock()
+
+	summary := make(map[string]int, len(versions))
+	for t, vs := range versions {
+		summary[t] = len(vs)
+	}
+	logger.Get().Infow("schema registry loaded", "dir", r.dir, "versions", summary)
+	return nil
+}
+
+// Types returns the registered event types, sorted.
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.versions))
+	for t := range r.versions {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Versions returns every version of eventType, oldest first.
+func (r *Registry) Versions(eventType string) ([]SchemaVersion, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	vs, ok := r.versions[eventType]
+	if !ok {
+		return nil, ErrSchemaNotFound
+	}
+	out := make([]SchemaVersion, len(vs))
+	for i, v := range vs {
+		out[i] = *v
+	}
+	return out, nil
+}
+
+// Get returns a version of eventType; version 0 means the latest.
+func (r *Registry) Get(eventType string, version int) (SchemaVersion, error) {
+	v, err := r.get(eventType, version)
+	if err != nil {
+		return SchemaVersion{}, err
+	}
+	return *v, nil
+}
+
+// Resolve returns the compiled schema validation should use for
+// eventType at version (0 = latest).
+func (r *Registry) Resolve(eventType string, version int) (*Schema, error) {
+	v, err := r.get(eventType, version)
+	if err != nil {
+		return nil, err
+	}
+	return v.compiled, nil
+}
+
+func (r *Registry) get(eventType string, version int) (*SchemaVersion, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	vs := r.versions[eventType]
+	if len(vs) == 0 {
+		return nil, ErrSchemaNotFound
+	}
+	if version == 0 {
+		return vs[len(vs)-1], nil
+	}
+	for _, v := range vs {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+	return nil, ErrSchemaNotFound
+}
+
+// Register adds raw as the next version of eventType after checking it
+// against the latest version under compat ("" = registry default).
+func (r *Registry) Register(eventType string, raw json.RawMessage, compat string) (SchemaVersion, error) {
+	if !validTypeName(eventType) {
+		return SchemaVersion{}, fmt.Errorf("invalid event type %q", eventType)
+	}
+	if compat == "" {
+		compat = r.defaultCompat
+	}
+	if err := checkCompatMode(compat); err != nil {
+		return SchemaVersion{}, err
+	}
+
+	compiled, err := ParseSchema(raw)
+	if err != nil {
+		return SchemaVersion{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	vs := r.versions[eventType]
+	next := 1
+	if len(vs) > 0 {
+		latest := vs[len(vs)-1]
+		if reasons := checkCompatibility(compat, compiled, latest.compiled); len(reasons) > 0 {
+			return SchemaVersion{}, &CompatibilityError{Mode: compat, Reasons: reasons}
+		}
+		next = latest.Version + 1
+	}
+
+	v := &SchemaVersion{
+		Type:      eventType,
+		Version:   next,
+		Schema:    raw,
+		CreatedAt: time.Now().UTC(),
+		compiled:  compiled,
+	}
+
+	typeDir := filepath.Join(r.dir, eventType)
+	if err := os.MkdirAll(typeDir, 0o755); err != nil {
+		return SchemaVersion{}, fmt.Errorf("failed to create schema dir: %w", err)
+	}
+	path := filepath.Join(typeDir, strconv.Itoa(next)+".json")
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		return SchemaVersion{}, fmt.Errorf("failed to write schema: %w", err)
+	}
+
+	if r.versions == nil {
+		r.versions = make(map[string][]*SchemaVersion)
+	}
+	r.versions[eventType] = append(vs, v)
+
+	logger.Get().Infow("schema registered",
+		"type", eventType,
+		"version", next,
+		"compatibility", compat,
+	)
+	return *v, nil
+}
+
+func loadRegistryDir(dir string) (map[string][]*SchemaVersion, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema dir: %w", err)
+	}
+
+	versions := make(map[string][]*SchemaVersion)
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case e.IsDir():
+			vs, err := loadTypeDir(filepath.Join(dir, name), name)
+			if err != nil {
+				return nil, err
+			}
+			versions[name] = append(versions[name], vs...)
+
+		case filepath.Ext(name) == ".json":
+			eventType := strings.TrimSuffix(name, ".json")
+			v, err := loadVersion(filepath.Join(dir, name), eventType, 1)
+			if err != nil {
+				return nil, err
+			}
+			versions[eventType] = append(versions[eventType], v)
+		}
+	}
+
+	for t, vs := range versions {
+		sort.Slice(vs, func(i, j int) bool { return vs[i].Version < vs[j].Version })
+		for i := 1; i < len(vs); i++ {
+			if vs[i].Version == vs[i-1].Version {
+				return nil, fmt.Errorf("schema %s: version %d defined twice", t, vs[i].Version)
+			}
+		}
+		if len(vs) == 0 {
+			delete(versions, t)
+		}
+	}
+	return versions, nil
+}
+
+func loadTypeDir(dir, eventType string) ([]*SchemaVersion, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema dir: %w", err)
+	}
+
+	var vs []*SchemaVersion
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil || n < 1 {
+			continue
+		}
+		v, err := loadVersion(filepath.Join(dir, e.Name()), eventType, n)
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+func loadVersion(path, eventType string, version int) (*SchemaVersion, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema %s: %w", path, err)
+	}
+	compiled, err := ParseSchema(raw)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", path, err)
+	}
+
+	var created time.Time
+	if info, err := os.Stat(path); err == nil {
+		created = info.ModTime().UTC()
+	}
+	return &SchemaVersion{
+		Type:      eventType,
+		Version:   version,
+		Schema:    json.RawMessage(raw),
+		CreatedAt: created,
+		compiled:  compiled,
+	}, nil
+}
+
+func checkCompatMode(mode string) error {
+	switch mode {
+	case CompatNone, CompatBackward, CompatForward, CompatFull:
+		return nil
+	default:
+		return fmt.Errorf("unknown compatibility mode %q", mode)
+	}
+}
+
+// validTypeName keeps event types usable as directory names.
+func validTypeName(t string) bool {
+	if t == "" || t == "." || t == ".." {
+		return false
+	}
+	for _, c := range t {
+		if !(c == '_' || c == '-' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package validator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/logger"
+)
+
+// RuleSet is the declarative rule file read by RuleValidator:
+//
+//	{
+//	  "max_payload_bytes": 65536,
+//	  "max_future_skew": "5m",
+//	  "max_past_skew": "24h",
+//	  "types": {
+//	    "sensor_data": {
+//	      "sources": ["iot"],
+//	      "required": ["temperature", "device.id"],
+//	      "ranges": {"temperature": {"min": -50, "max": 150}},
+//	      "patterns": {"device.id": "^dev-[0-9]+$"}
+//	    },
+//	    "user_action": {}
+//	  }
+//	}
+//
+// When types is set only the listed types are allowed. Data keys may use
+// dots to reach into nested objects.
+type RuleSet struct {
+	MaxPayloadBytes int                  `json:"max_payload_bytes,omitempty"`
+	MaxFutureSkew   Duration             `json:"max_future_skew,omitempty"`
+	MaxPastSkew     Duration             `json:"max_past_skew,omitempty"`
+	Types           map[string]*TypeRule `json:"types,omitempty"`
+}
+
+// TypeRule holds the rules for one event type.
+type TypeRule struct {
+	Sources  []string          `json:"sources,omitempty"`
+	Required []string          `json:"required,omitempty"`
+	Ranges   map[string]Range  `json:"ranges,omitempty"`
+	Patterns map[string]string `json:"patterns,omitempty"`
+
+	patterns map[string]*regexp.Regexp
+}
+
+// Range bounds a numeric data key; either side may be omitted.
+type Range struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// Duration is a time.Duration written as a Go duration string ("5m").
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5m\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ParseRules decodes and compiles a rule file.
+func ParseRules(data []byte) (*RuleSet, error) {
+	var rs RuleSet
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rs); err != nil {
+		return nil, fmt.Errorf("invalid rules: %w", err)
+	}
+
+	for t, rule := range rs.Types {
+		if rule == nil {
+			rule = &TypeRule{}
+			rs.Types[t] = rule
+		}
+		rule.patterns = make(map[string]*regexp.Regexp, len(rule.Patterns))
+		for key, expr := range rule.Patterns {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("rules for %s: invalid pattern for %s: %w", t, key, err)
+			}
+			rule.patterns[key] = re
+		}
+	}
+	return &rs, nil
+}
+
+// Check records every rule e breaks in verr. now is the reference time
+// for the timestamp skew limits.
+func (rs *RuleSet) Check(e pipeline.Event, now time.Time, verr *pipeline.ValidationError) {
+	if rs.MaxPayloadBytes > 0 && e.Data != nil {
+		if b, err := json.Marshal(e.Data); err == nil && len(b) > rs.MaxPayloadBytes {
+			verr.Add("/data", fmt.Sprintf("payload is %d bytes, limit is %d", len(b), rs.MaxPayloadBytes))
+		}
+	}
+
+	if !e.Timestamp.IsZero() {
+		if max := time.Duration(rs.MaxFutureSkew); max > 0 && e.Timestamp.Sub(now) > max {
+			verr.Add("/timestamp", fmt.Sprintf("more than %s in the future", max))
+		}
+		if max := time.Duration(rs.MaxPastSkew); max > 0 && now.Sub(e.Timestamp) > max {
+			verr.Add("/timestamp", fmt.Sprintf("more than %s in the past", max))
+		}
+	}
+
+	if len(rs.Types) == 0 || e.Type == "" {
+		return
+	}
+	rule, ok := rs.Types[e.Type]
+	if !ok {
+		verr.Add("/type", fmt.Sprintf("type %q is not allowed", e.Type))
+		return
+	}
+	rule.check(e, verr)
+}
+
+func (r *TypeRule) check(e pipeline.Event, verr *pipeline.ValidationError) {
+	if len(r.Sources) > 0 && e.Source != "" && !containsString(r.Sources, e.Source) {
+		verr.Add("/source", fmt.Sprintf("source %q is not allowed for type %q", e.Source, e.Type))
+	}
+
+	for _, key := range r.Required {
+		if _, ok := lookupKey(e.Data, key); !ok {
+			verr.Add(dataPointer(key), "is required")
+		}
+	}
+
+	for _, key := range sortedKeys(r.Ranges) {
+		v, ok := lookupKey(e.Data, key)
+		if !ok {
+			continue
+		}
+		n, isNum := normalize(v).(float64)
+		if !isNum {
+			verr.Add(dataPointer(key), "must be a number")
+			continue
+		}
+		rng := r.Ranges[key]
+		if rng.Min != nil && n < *rng.Min {
+			verr.Add(dataPointer(key), fmt.Sprintf("must be >= %v", *rng.Min))
+		}
+		if rng.Max != nil && n > *rng.Max {
+			verr.Add(dataPointer(key), fmt.Sprintf("must be <= %v", *rng.Max))
+		}
+	}
+
+	for _, key := range sortedKeys(r.patterns) {
+		v, ok := lookupKey(e.Data, key)
+		if !ok {
+			continue
+		}
+		s, isStr := v.(string)
+		if !isStr {
+			verr.Add(dataPointer(key), "must be a string")
+			continue
+		}
+		if !r.patterns[key].MatchString(s) {
+			verr.Add(dataPointer(key), fmt.Sprintf("must match pattern %q", r.Patterns[key]))
+		}
+	}
+}
+
+// lookupKey resolves a dotted key in the event data.
+func lookupKey(data map[string]interface{}, key string) (interface{}, bool) {
+	var cur interface{} = data
+	for _, part := range strings.Split(key, ".") {
+		obj, ok := normalize(cur).(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func dataPointer(key string) string {
+	parts := strings.Split(key, ".")
+	for i, p := range parts {
+		parts[i] = escapePointer(p)
+	}
+	return "/data/" + strings.Join(parts, "/")
+}
+
+// RuleValidator checks events against a rule file that can be reloaded
+// at runtime, so limits can be tightened without a deploy.
+type RuleValidator struct {
+	path string
+
+	mu    sync.RWMutex
+	rules *RuleSet
+}
+
+// NewRuleValidator loads the rule file at path.
+func NewRuleValidator(path string) (*RuleValidator, error) {
+	v := &RuleValidator{path: path}
+	if err := v.Reload(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Reload re-reads the rule file. If it fails to load the previous rules
+// stay active and the error is returned.
+func (v *RuleValidator) Reload() error {
+	raw, err := os.ReadFile(v.path)
+	if err != nil {
+		return fmt.Errorf("failed to read rules: %w", err)
+	}
+	rules, err := ParseRules(raw)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.rules = rules
+	v.mu.Unlock()
+
+	logger.Get().Infow("validation rules loaded", "path", v.path, "types", sortedKeys(rules.Types))
+	return nil
+}
+
+// Rules returns the active rule set.
+func (v *RuleValidator) Rules() *RuleSet {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.rules
+}
+
+func (v *RuleValidator) Validate(ctx context.Context, e pipeline.Event) error {
+	verr := &pipeline.ValidationError{}
+	v.Rules().Check(e, time.Now(), verr)
+	return verr.ErrOrNil()
+}
@@ -0,0 +1,343 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"event-pipeline/internal/pipeline"
+	"github.com/google/uuid"
+)
+
+// Schema is a compiled JSON Schema document. It supports the subset of
+// draft 2020-12 that event payloads need: type, enum, const, properties,
+// required, additionalProperties, items, numeric and length bounds,
+// pattern and a few formats. Unknown keywords are ignored.
+type Schema struct {
+	Types                []string           `json:"-"`
+	RawType              json.RawMessage    `json:"type,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Const                interface{}        `json:"const,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Format               string             `json:"format,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// ParseSchema decodes and compiles a schema document.
+func ParseSchema(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid schema JSON: %w", err)
+	}
+	if err := s.compile(""); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Schema) compile(path string) error {
+	if len(s.RawType) > 0 {
+		var one string
+		if err := json.Unmarshal(s.RawType, &one); err == nil {
+			s.Types = []string{one}
+		} else if err := json.Unmarshal(s.RawType, &s.Types); err != nil {
+			return fmt.Errorf("%s: type must be a string or an array of strings", pointerOrRoot(path))
+		}
+	}
+	for _, t := range s.Types {
+		switch t {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return fmt.Errorf("%s: unknown type %q", pointerOrRoot(path), t)
+		}
+	}
+
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern: %w", pointerOrRoot(path), err)
+		}
+		s.pattern = re
+	}
+
+	for name, prop := range s.Properties {
+		if prop == nil {
+			return fmt.Errorf("%s: property schema must be an object", pointerOrRoot(path+"/"+escapePointer(name)))
+		}
+		if err := prop.compile(path + "/" + escapePointer(name)); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.compile(path + "/items"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks v against the schema and records every violation in
+// verr, with fields reported as JSON pointers below base.
+func (s *Schema) Validate(v interface{}, base string, verr *pipeline.ValidationError) {
+	v = normalize(v)
+
+	if len(s.Types) > 0 && !s.matchesType(v) {
+		verr.Add(pointerOrRoot(base), fmt.Sprintf("expected %s, got %s", strings.Join(s.Types, " or "), jsonType(v)))
+		// further keywords would only repeat the mismatch
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if equalJSON(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			verr.Add(pointerOrRoot(base), fmt.Sprintf("must be one of %s", formatEnum(s.Enum)))
+		}
+	}
+	if s.Const != nil && !equalJSON(v, s.Const) {
+		verr.Add(pointerOrRoot(base), fmt.Sprintf("must equal %v", s.Const))
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		s.validateObject(val, base, verr)
+	case []interface{}:
+		s.validateArray(val, base, verr)
+	case string:
+		s.validateString(val, base, verr)
+	case float64:
+		s.validateNumber(val, base, verr)
+	}
+}
+
+func (s *Schema) validateObject(obj map[string]interface{}, base string, verr *pipeline.ValidationError) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			verr.Add(base+"/"+escapePointer(name), "is required")
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		prop, ok := s.Properties[k]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				verr.Add(base+"/"+escapePointer(k), "is not allowed")
+			}
+			continue
+		}
+		prop.Validate(obj[k], base+"/"+escapePointer(k), verr)
+	}
+}
+
+func (s *Schema) validateArray(arr []interface{}, base string, verr *pipeline.ValidationError) {
+	if s.MinItems != nil && len(arr) < *s.MinItems {
+		verr.Add(pointerOrRoot(base), fmt.Sprintf("must have at least %d items", *s.MinItems))
+	}
+	if s.MaxItems != nil && len(arr) > *s.MaxItems {
+		verr.Add(pointerOrRoot(base), fmt.Sprintf("must have at most %d items", *s.MaxItems))
+	}
+	if s.Items != nil {
+		for i, item := range arr {
+			s.Items.Validate(item, fmt.Sprintf("%s/%d", base, i), verr)
+		}
+	}
+}
+
+func (s *Schema) validateString(str string, base string, verr *pipeline.ValidationError) {
+	n := len([]rune(str))
+	if s.MinLength != nil && n < *s.MinLength {
+		verr.Add(pointerOrRoot(base), fmt.Sprintf("must be at least %d characters", *s.MinLength))
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		verr.Add(pointerOrRoot(base), fmt.Sprintf("must be at most %d characters", *s.MaxLength))
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		verr.Add(pointerOrRoot(base), fmt.Sprintf("must match pattern %q", s.Pattern))
+	}
+	if s.Format != "" && !validFormat(s.Format, str) {
+		verr.Add(pointerOrRoot(base), fmt.Sprintf("must be a valid %s", s.Format))
+	}
+}
+
+func (s *Schema) validateNumber(n float64, base string, verr *pipeline.ValidationError) {
+	if s.Minimum != nil && n < *s.Minimum {
+		verr.Add(pointerOrRoot(base), fmt.Sprintf("must be >= %v", *s.Minimum))
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		verr.Add(pointerOrRoot(base), fmt.Sprintf("must be <= %v", *s.Maximum))
+	}
+	if s.ExclusiveMinimum != nil && n <= *s.ExclusiveMinimum {
+		verr.Add(pointerOrRoot(base), fmt.Sprintf("must be > %v", *s.ExclusiveMinimum))
+	}
+	if s.ExclusiveMaximum != nil && n >= *s.ExclusiveMaximum {
+		verr.Add(pointerOrRoot(base), fmt.Sprintf("must be < %v", *s.ExclusiveMaximum))
+	}
+}
+
+func (s *Schema) matchesType(v interface{}) bool {
+	actual := jsonType(v)
+	for _, t := range s.Types {
+		if t == actual {
+			return true
+		}
+		if t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize maps Go values built in code (ints, typed maps and slices) to
+// the shapes encoding/json produces, so payloads validate the same way
+// whether they came over HTTP or not.
+func normalize(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil, bool, string, float64, map[string]interface{}, []interface{}:
+		return v
+	case json.Number:
+		f, _ := val.Float64()
+		return f
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			out[i] = rv.Index(i).Interface()
+		}
+		return out
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return v
+		}
+		out := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			out[k.String()] = rv.MapIndex(k).Interface()
+		}
+		return out
+	}
+	return v
+}
+
+func jsonType(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if val == math.Trunc(val) && !math.IsInf(val, 0) {
+			return "integer"
+		}
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func equalJSON(a, b interface{}) bool {
+	return reflect.DeepEqual(normalizeDeep(a), normalizeDeep(b))
+}
+
+func normalizeDeep(v interface{}) interface{} {
+	v = normalize(v)
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, e := range val {
+			out[k] = normalizeDeep(e)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, e := range val {
+			out[i] = normalizeDeep(e)
+		}
+		return out
+	}
+	return v
+}
+
+func formatEnum(values []interface{}) string {
+	b, _ := json.Marshal(values)
+	return string(b)
+}
+
+func validFormat(format, s string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Address == s
+	case "uuid":
+		_, err := uuid.Parse(s)
+		return err == nil
+	case "ipv4":
+		ip := net.ParseIP(s)
+		return ip != nil && ip.To4() != nil && strings.Count(s, ".") == 3
+	case "ipv6":
+		ip := net.ParseIP(s)
+		return ip != nil && strings.Contains(s, ":")
+	default:
+		// unknown formats are annotations only
+		return true
+	}
+}
+
+// escapePointer escapes a key for use as a JSON pointer token (RFC 6901).
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+func pointerOrRoot(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return p
+}
@@ -0,0 +1,91 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"event-pipeline/internal/pipeline"
+)
+
+// SchemaValidator extends BasicValidator with a JSON Schema per event
+// type, applied to the event's Data. Schemas come from a versioned
+// Registry; an event selects one with schema_version and otherwise gets
+// the latest version of its type.
+type SchemaValidator struct {
+	// RequireSchema rejects events whose type has no schema; otherwise
+	// their payload is not checked.
+	RequireSchema bool
+	// Types restricts the accepted event types, as in BasicValidator.
+	Types *pipeline.EventTypes
+
+	registry *Registry
+}
+
+// NewSchemaValidator loads every schema in dir.
+func NewSchemaValidator(dir string) (*SchemaValidator, error) {
+	r, err := NewRegistry(dir, "")
+	if err != nil {
+		return nil, err
+	}
+	return NewRegistryValidator(r), nil
+}
+
+// NewRegistryValidator validates against the schemas held by r.
+func NewRegistryValidator(r *Registry) *SchemaValidator {
+	return &SchemaValidator{registry: r}
+}
+
+// Registry returns the registry the validator resolves schemas from.
+func (v *SchemaValidator) Registry() *Registry {
+	return v.registry
+}
+
+// Reload re-reads the schema directory. If any schema fails to load the
+// previous set stays active and the error is returned.
+func (v *SchemaValidator) Reload() error {
+	return v.registry.Reload()
+}
+
+// Schema returns the latest schema for an event type.
+func (v *SchemaValidator) Schema(eventType string) (*Schema, bool) {
+	s, err := v.registry.Resolve(eventType, 0)
+	return s, err == nil
+}
+
+func (v *SchemaValidator) Validate(ctx context.Context, e pipeline.Event) error {
+	verr := &pipeline.ValidationError{}
+	basic := BasicValidator{Types: v.Types}
+	if err := basic.Validate(ctx, e); err != nil {
+		verr.Fields = append(verr.Fields, fieldsOf(err)...)
+	}
+
+	if e.SchemaVersion < 0 {
+		verr.Add("/schema_version", "must be a positive integer")
+	} else if e.Type != "" {
+		schema, err := v.registry.Resolve(e.Type, e.SchemaVersion)
+		switch {
+		case err == nil:
+			var data interface{} = map[string]interface{}{}
+			if e.Data != nil {
+				data = e.Data
+			}
+			schema.Validate(data, "/data", verr)
+		case e.SchemaVersion > 0:
+			verr.Add("/schema_version", fmt.Sprintf("type %q has no schema version %d", e.Type, e.SchemaVersion))
+		case v.RequireSchema:
+			verr.Add("/type", fmt.Sprintf("no schema registered for type %q", e.Type))
+		}
+	}
+
+	return verr.ErrOrNil()
+}
+
+// fieldsOf turns any validator error into field errors.
+func fieldsOf(err error) []pipeline.FieldError {
+	var verr *pipeline.ValidationError
+	if errors.As(err, &verr) {
+		return verr.Fields
+	}
+	return []pipeline.FieldError{{Message: err.Error()}}
+}
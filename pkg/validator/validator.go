@@ -2,29 +2,38 @@ package validator
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"strings"
 
 	"event-pipeline/internal/pipeline"
 	"github.com/google/uuid"
 )
 
-type BasicValidator struct{}
+type BasicValidator struct {
+	// Types, if set, is the registry of accepted event types; without it
+	// any non-empty type passes.
+	Types *pipeline.EventTypes
+}
 
 func (v *BasicValidator) Validate(ctx context.Context, e pipeline.Event) error {
+	verr := &pipeline.ValidationError{}
+
 	// Check required fields
 	if e.Type == "" {
-		return errors.New("missing type")
+		verr.Add("/type", "missing type")
+	} else if v.Types != nil && !v.Types.Allowed(e.Type) {
+		verr.Add("/type", fmt.Sprintf("unknown type %q, allowed: %s", e.Type, strings.Join(v.Types.List(), ", ")))
 	}
 	if e.Source == "" {
-		return errors.New("missing source")
+		verr.Add("/source", "missing source")
 	}
 
 	// Check UUID format if provided
 	if e.ID != "" {
 		if _, err := uuid.Parse(e.ID); err != nil {
-			return errors.New("invalid UUID format")
+			verr.Add("/id", "invalid UUID format")
 		}
 	}
 
-	return nil
+	return verr.ErrOrNil()
 }
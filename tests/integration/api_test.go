@@ -69,7 +69,7 @@ func setupTestServer() (*httptest.Server, *pipeline.EventPipeline, *mockStorage)
 func TestHealthEndpoint(t *testing.T) {
 	ts, p, _ := setupTestServer()
 	defer ts.Close()
-	defer p.Shutdown()
+	defer p.Shutdown(context.Background())
 
 	resp, err := http.Get(ts.URL + "/health")
 	if err != nil {
@@ -83,7 +83,7 @@ func TestHealthEndpoint(t *testing.T) {
 func TestPostSingleEvent(t *testing.T) {
 	ts, p, store := setupTestServer()
 	defer ts.Close()
-	defer p.Shutdown()
+	defer p.Shutdown(context.Background())
 
 	payload := `{"type":"user_action","source":"web","data":{"action":"click"}}`
 	resp, err := http.Post(ts.URL+"/events", "application/json", bytes.NewBufferString(payload))
@@ -107,7 +107,7 @@ func TestPostSingleEvent(t *testing.T) {
 func TestPostBatchEvents(t *testing.T) {
 	ts, p, store := setupTestServer()
 	defer ts.Close()
-	defer p.Shutdown()
+	defer p.Shutdown(context.Background())
 
 	payload := `{"events":[
 		{"type":"sensor_data","source":"iot_device","data":{"temperature":23.5}},
@@ -134,7 +134,7 @@ func TestPostBatchEvents(t *testing.T) {
 func TestMetricsEndpoint(t *testing.T) {
 	ts, p, _ := setupTestServer()
 	defer ts.Close()
-	defer p.Shutdown()
+	defer p.Shutdown(context.Background())
 
 	// send one event
 	payload := `{"type":"user_action","source":"web","data":{"action":"login"}}`
@@ -210,7 +210,7 @@ func TestAPIRetryAndFailureMetrics(t *testing.T) {
 	server.RegisterRoutes(mux)
 	ts := httptest.NewServer(mux)
 	defer ts.Close()
-	defer p.Shutdown()
+	defer p.Shutdown(context.Background())
 
 	payload := `{"type":"system_log","source":"api","data":{"msg":"fail"}}`
 	resp, err := http.Post(ts.URL+"/events", "application/json", bytes.NewBufferString(payload))
@@ -274,7 +274,7 @@ func TestAPIRetryAndSuccessAfterRetries(t *testing.T) {
 	server.RegisterRoutes(mux)
 	ts := httptest.NewServer(mux)
 	defer ts.Close()
-	defer p.Shutdown()
+	defer p.Shutdown(context.Background())
 
 	// Send one event
 	payload := `{"type":"system_log","source":"api","data":{"msg":"retry-success"}}`
@@ -349,7 +349,7 @@ func TestAPIBatchRetryAndSuccessAfterRetries(t *testing.T) {
 	server.RegisterRoutes(mux)
 	ts := httptest.NewServer(mux)
 	defer ts.Close()
-	defer p.Shutdown()
+	defer p.Shutdown(context.Background())
 
 	// Batch of 2 events with valid UUIDs
 	payload := fmt.Sprintf(`{"events":[
@@ -404,3 +404,179 @@ func TestAPIBatchRetryAndSuccessAfterRetries(t *testing.T) {
 		t.Errorf("expected %d store attempts, got %d", expectedCalls, store.Calls)
 	}
 }
+
+func TestPostBatchEventsReturnsPerItemResults(t *testing.T) {
+	ts, p, _ := setupTestServer()
+	defer ts.Close()
+	defer p.Shutdown(context.Background())
+
+	explicitID := uuid.New().String()
+	payload := fmt.Sprintf(`{"events":[
+		{"type":"sensor_data","source":"iot_device","data":{"temperature":23.5}},
+		{"id":"%s","type":"system_log","source":"system","data":{"level":"info"}}
+	]}`, explicitID)
+	resp, err := http.Post(ts.URL+"/events/batch", "application/json", bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected 202, got %d", resp.StatusCode)
+	}
+
+	var body api.BatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Accepted != 2 || body.Rejected != 0 || len(body.Results) != 2 {
+		t.Fatalf("unexpected batch response: %+v", body)
+	}
+	if _, err := uuid.Parse(body.Results[0].ID); err != nil {
+		t.Errorf("expected generated UUID for item 0, got %q", body.Results[0].ID)
+	}
+	if body.Results[1].ID != explicitID {
+		t.Errorf("expected item 1 to keep ID %s, got %s", explicitID, body.Results[1].ID)
+	}
+	for _, r := range body.Results {
+		if r.Status != api.ItemAccepted {
+			t.Errorf("expected item %d accepted, got %s", r.Index, r.Status)
+		}
+	}
+}
+
+func TestPostBatchEventsPartialAcceptance(t *testing.T) {
+	store := testmocks.NewBlockingStorage()
+	metrics := pipeline.NewMetrics()
+	cfg := &config.Config{
+		WorkerCount:      1,
+		QueueSize:        1,
+		MaxRetries:       3,
+		RetryBaseBackoff: 20 * time.Millisecond,
+	}
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, metrics, cfg)
+	server := api.NewServer(p)
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// pin the only worker so the queue holds exactly one more event
+	if err := p.Ingest(pipeline.Event{Type: "user_action", Source: "web"}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for metrics.GetReceived() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for worker")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	payload := `{"events":[
+		{"type":"user_action","source":"web"},
+		{"type":"user_action","source":"web"},
+		{"type":"user_action","source":"web"}
+	]}`
+	resp, err := http.Post(ts.URL+"/events/batch", "application/json", bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected 202 for partial acceptance, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("expected Retry-After header for throttled items")
+	}
+
+	var body api.BatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Accepted != 1 || body.Rejected != 2 {
+		t.Errorf("expected 1 accepted / 2 rejected, got %+v", body)
+	}
+	for _, r := range body.Results[1:] {
+		if r.Status != api.ItemRejected || r.Reason == "" || r.ID == "" {
+			t.Errorf("expected rejected item with reason and ID, got %+v", r)
+		}
+	}
+
+	close(store.Release)
+	p.Shutdown(context.Background())
+}
+
+func TestPostInvalidEventReturns422(t *testing.T) {
+	ts, p, store := setupTestServer()
+	defer ts.Close()
+	defer p.Shutdown(context.Background())
+
+	payload := `{"id":"not-a-uuid","source":"web","data":{"action":"click"}}`
+	resp, err := http.Post(ts.URL+"/events", "application/json", bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", resp.StatusCode)
+	}
+
+	var body api.ValidationErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]bool{}
+	for _, f := range body.Fields {
+		fields[f.Field] = true
+	}
+	if !fields["/type"] || !fields["/id"] {
+		t.Errorf("expected violations for /type and /id, got %+v", body.Fields)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if p.Metrics().GetReceived() != 0 || len(store.stored) != 0 {
+		t.Errorf("expected invalid event never to reach the pipeline")
+	}
+}
+
+func TestPostBatchWithInvalidItems(t *testing.T) {
+	ts, p, _ := setupTestServer()
+	defer ts.Close()
+	defer p.Shutdown(context.Background())
+
+	payload := `{"events":[
+		{"type":"user_action","source":"web"},
+		{"type":"user_action"}
+	]}`
+	resp, err := http.Post(ts.URL+"/events/batch", "application/json", bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected 202, got %d", resp.StatusCode)
+	}
+
+	var body api.BatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Accepted != 1 || body.Rejected != 1 {
+		t.Fatalf("unexpected batch response: %+v", body)
+	}
+	invalid := body.Results[1]
+	if invalid.Status != api.ItemInvalid || len(invalid.Fields) != 1 || invalid.Fields[0].Field != "/source" {
+		t.Errorf("expected /source violation on item 1, got %+v", invalid)
+	}
+
+	// a batch with nothing valid is a 422
+	resp2, err := http.Post(ts.URL+"/events/batch", "application/json", bytes.NewBufferString(`{"events":[{"source":"web"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", resp2.StatusCode)
+	}
+}
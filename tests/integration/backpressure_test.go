@@ -0,0 +1,81 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"event-pipeline/internal/api"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackpressureReturns429WhenQueueFull(t *testing.T) {
+	store := testmocks.NewBlockingStorage()
+	metrics := pipeline.NewMetrics()
+	cfg := &config.Config{
+		WorkerCount:      1,
+		QueueSize:        1,
+		MaxRetries:       3,
+		RetryBaseBackoff: 20 * time.Millisecond,
+		EnqueueTimeout:   20 * time.Millisecond,
+	}
+
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, metrics, cfg)
+	server := api.NewServer(p)
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	post := func() *http.Response {
+		t.Helper()
+		payload := `{"type":"user_action","source":"web"}`
+		resp, err := http.Post(ts.URL+"/events", "application/json", bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// first event pins the only worker inside Store
+	if resp := post(); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", resp.StatusCode)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for metrics.GetReceived() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for worker to pick up the first event")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// second event fills the queue
+	if resp := post(); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", resp.StatusCode)
+	}
+
+	// third one has nowhere to go
+	resp := post()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+	if metrics.GetRejected() != 1 {
+		t.Errorf("expected rejected=1, got %d", metrics.GetRejected())
+	}
+
+	close(store.Release)
+	p.Shutdown(context.Background())
+
+	if len(store.Events) != 2 {
+		t.Errorf("expected 2 events stored, got %d", len(store.Events))
+	}
+}
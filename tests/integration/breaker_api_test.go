@@ -0,0 +1,78 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"event-pipeline/internal/api"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/internal/storage"
+	"event-pipeline/pkg/validator"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type downStorage struct{}
+
+func (downStorage) Store(context.Context, []pipeline.ProcessedEvent) error {
+	return errors.New("connection refused")
+}
+
+func TestBreakerStateInHealthAndMetrics(t *testing.T) {
+	metrics := pipeline.NewMetrics()
+	breaker := storage.NewBreaker("mysql", downStorage{}, storage.BreakerConfig{Failures: 1, OpenMS: 60000})
+	breaker.SetMetrics(metrics)
+
+	cfg := &config.Config{WorkerCount: 1, QueueSize: 10, MaxRetries: 1}
+	p := pipeline.NewEventPipeline(breaker, &pipeline.JSONProcessor{}, &validator.BasicValidator{}, metrics, cfg)
+	defer p.Shutdown(context.Background())
+	mux := http.NewServeMux()
+	api.NewServer(p).RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	get := func(path string) (int, map[string]interface{}) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, body
+	}
+
+	_, body := get("/health")
+	if body["degraded"] != false || body["storage"].(map[string]interface{})["mysql"] != "closed" {
+		t.Fatalf("health before failures = %v", body)
+	}
+
+	p.Ingest(pipeline.Event{Type: "user_action", Source: "test"})
+	deadline := time.Now().Add(2 * time.Second)
+	for breaker.State() != storage.BreakerOpen {
+		if time.Now().After(deadline) {
+			t.Fatal("breaker did not open")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	status, body := get("/health")
+	if status != http.StatusOK || body["healthy"] != true || body["degraded"] != true {
+		t.Errorf("health with an open breaker = %d %v", status, body)
+	}
+	if body["storage"].(map[string]interface{})["mysql"] != "open" {
+		t.Errorf("health storage = %v, want mysql open", body["storage"])
+	}
+
+	_, body = get("/metrics")
+	st, ok := body["circuit_breakers"].(map[string]interface{})["mysql"].(map[string]interface{})
+	if !ok || st["state"] != "open" || st["trips"] != 1.0 {
+		t.Errorf("metrics circuit_breakers = %v", body["circuit_breakers"])
+	}
+}
@@ -0,0 +1,112 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"event-pipeline/internal/api"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeyDeduplicatesRetries(t *testing.T) {
+	store := &testmocks.MockStorage{}
+	cfg := &config.Config{
+		WorkerCount:      1,
+		QueueSize:        100,
+		MaxRetries:       3,
+		RetryBaseBackoff: 20 * time.Millisecond,
+		DedupTTL:         time.Minute,
+		DedupMaxKeys:     100,
+	}
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, pipeline.NewMetrics(), cfg)
+	server := api.NewServer(p)
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	post := func(key string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/events",
+			bytes.NewBufferString(`{"type":"user_action","source":"web","data":{"action":"click"}}`))
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// client retries the same request three times
+	for i := 0; i < 3; i++ {
+		if status := post("order-42"); status != http.StatusAccepted {
+			t.Errorf("expected 202, got %d", status)
+		}
+	}
+	if status := post("order-43"); status != http.StatusAccepted {
+		t.Errorf("expected 202, got %d", status)
+	}
+
+	p.Shutdown(context.Background())
+
+	if len(store.Events) != 2 {
+		t.Fatalf("expected 2 distinct events stored, got %d", len(store.Events))
+	}
+	if store.Events[0].ID == store.Events[1].ID {
+		t.Error("expected different keys to yield different event IDs")
+	}
+	if p.Metrics().GetDuplicates() != 2 {
+		t.Errorf("expected duplicates=2, got %d", p.Metrics().GetDuplicates())
+	}
+}
+
+func TestBatchGeneratedIDsDoNotEvictClientIDs(t *testing.T) {
+	store := &testmocks.MockStorage{}
+	cfg := &config.Config{
+		WorkerCount:  1,
+		QueueSize:    100,
+		MaxRetries:   1,
+		DedupTTL:     time.Minute,
+		DedupMaxKeys: 2,
+	}
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, pipeline.NewMetrics(), cfg)
+	server := api.NewServer(p)
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	post := func(body string) {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/events/batch", "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d", resp.StatusCode)
+		}
+	}
+
+	client := `{"id":"6f1c2b9e-5d3a-4c7e-9a1b-2e4f6a8c0d12","type":"user_action","source":"web"}`
+	post(`{"events":[` + client + `]}`)
+	// more ID-less events than the cache holds
+	post(`{"events":[{"type":"user_action","source":"web"},{"type":"user_action","source":"web"},{"type":"user_action","source":"web"}]}`)
+	post(`{"events":[` + client + `]}`)
+
+	p.Shutdown(context.Background())
+
+	if len(store.Events) != 4 {
+		t.Errorf("expected 4 events stored, got %d", len(store.Events))
+	}
+	if p.Metrics().GetDuplicates() != 1 {
+		t.Errorf("expected duplicates=1, got %d", p.Metrics().GetDuplicates())
+	}
+}
@@ -0,0 +1,154 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"event-pipeline/internal/api"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/internal/storage"
+	"event-pipeline/pkg/processor"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplayDeadLettersAPI(t *testing.T) {
+	dlq, err := storage.NewFileDeadLetterSink(filepath.Join(t.TempDir(), "dlq.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dlq.Close()
+
+	now := time.Now().UTC()
+	sensor := pipeline.NewEvent(pipeline.Event{Type: "sensor_data", Source: "iot", Data: map[string]interface{}{"temperature": 21.5}})
+	action := pipeline.NewEvent(pipeline.Event{Type: "user_action", Source: "web"})
+	letters := []pipeline.DeadLetter{
+		{ID: "dl-1", Event: sensor, Stage: pipeline.StageStorage, Error: "db down", Attempts: 3, FailedAt: now},
+		{ID: "dl-2", Event: action, Stage: pipeline.StageProcessing, Error: "boom", Attempts: 1, FailedAt: now},
+	}
+	if err := dlq.Write(context.Background(), letters); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &testmocks.MockStorage{}
+	cfg := &config.Config{
+		WorkerCount:      1,
+		QueueSize:        100,
+		MaxRetries:       3,
+		RetryBaseBackoff: 20 * time.Millisecond,
+	}
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, pipeline.NewMetrics(), cfg)
+	server := api.NewServer(p)
+	server.DeadLetters = dlq
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	replay := func(body string) pipeline.ReplayResult {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/admin/dead-letters/replay", "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var res pipeline.ReplayResult
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	// dry run only reports the match
+	res := replay(`{"stage":"storage","dry_run":true}`)
+	if res.Matched != 1 || res.Replayed != 0 || res.EventIDs[0] != sensor.ID {
+		t.Errorf("unexpected dry run result: %+v", res)
+	}
+
+	res = replay(`{"stage":"storage"}`)
+	if res.Replayed != 1 {
+		t.Errorf("expected 1 replayed, got %+v", res)
+	}
+
+	// already replayed letters are skipped on the next run
+	res = replay(`{"stage":"storage"}`)
+	if res.Matched != 0 {
+		t.Errorf("expected replayed letter to be skipped, got %+v", res)
+	}
+
+	p.Shutdown(context.Background())
+
+	if len(store.Events) != 1 || store.Events[0].ID != sensor.ID {
+		t.Fatalf("expected replayed event to keep its ID %s, got %+v", sensor.ID, store.Events)
+	}
+
+	all, err := dlq.List(context.Background(), pipeline.DeadLetterFilter{IncludeReplayed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dl := range all {
+		switch dl.ID {
+		case "dl-1":
+			if dl.ReplayStatus != pipeline.ReplayStatusReplayed || dl.ReplayCount != 1 || dl.ReplayedAt == nil {
+				t.Errorf("expected replay outcome on dl-1, got %+v", dl)
+			}
+		case "dl-2":
+			if dl.ReplayStatus != "" {
+				t.Errorf("expected dl-2 untouched, got %+v", dl)
+			}
+		}
+	}
+}
+
+func TestReplayStorageLetterSkipsProcessors(t *testing.T) {
+	dlq, err := storage.NewFileDeadLetterSink(filepath.Join(t.TempDir(), "dlq.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dlq.Close()
+
+	tr, err := processor.ParseTransform([]byte(`{"transforms": {"user_action": [{"op": "hash", "field": "email", "salt": "s"}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := pipeline.NewProcessorChain(pipeline.ChainStage{Name: "transform", Stage: tr})
+	cfg := &config.Config{WorkerCount: 1, QueueSize: 10, MaxRetries: 1}
+
+	ev := pipeline.NewEvent(pipeline.Event{Type: "user_action", Source: "web", Data: map[string]interface{}{"email": "jane@example.com"}})
+	once, err := chain.Process(context.Background(), ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// storage is down, the processed event is dead-lettered
+	failing := &testmocks.FlakyStorage{AlwaysFailIDs: map[string]bool{ev.ID: true}}
+	p := pipeline.NewEventPipeline(failing, chain, &validator.BasicValidator{}, pipeline.NewMetrics(), cfg, pipeline.WithDeadLetterSink(dlq))
+	if err := p.Ingest(ev); err != nil {
+		t.Fatal(err)
+	}
+	p.Shutdown(context.Background())
+
+	store := &testmocks.MockStorage{}
+	p = pipeline.NewEventPipeline(store, chain, &validator.BasicValidator{}, pipeline.NewMetrics(), cfg)
+	res, err := p.Replay(context.Background(), dlq, pipeline.DeadLetterFilter{Stage: pipeline.StageStorage}, false)
+	if err != nil || res.Replayed != 1 {
+		t.Fatalf("replay = %+v, %v", res, err)
+	}
+	p.Shutdown(context.Background())
+
+	if len(store.Events) != 1 {
+		t.Fatalf("expected 1 event stored, got %d", len(store.Events))
+	}
+	if got, want := store.Events[0].Data["email"], once.Data["email"]; got != want {
+		t.Errorf("stored email = %v, want a single hash %v", got, want)
+	}
+}
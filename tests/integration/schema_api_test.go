@@ -0,0 +1,99 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"event-pipeline/internal/api"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSchemaRegistryAPI(t *testing.T) {
+	dir := t.TempDir()
+	v1 := `{"type": "object", "required": ["action"], "properties": {"action": {"type": "string"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "user_action.json"), []byte(v1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	registry, err := validator.NewRegistry(dir, validator.CompatBackward)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{WorkerCount: 1, QueueSize: 10, MaxRetries: 1, RetryBaseBackoff: time.Millisecond}
+	p := pipeline.NewEventPipeline(&mockStorage{}, &mockProcessor{}, validator.NewRegistryValidator(registry), pipeline.NewMetrics(), cfg)
+	defer p.Shutdown(context.Background())
+
+	server := api.NewServer(p)
+	server.Schemas = registry
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	register := func(body string) *http.Response {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/schemas/user_action", "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// making a property required breaks backward compatibility
+	resp := register(`{"schema": {"type": "object", "required": ["action", "page"]}}`)
+	var conflict api.SchemaConflictResponse
+	_ = json.NewDecoder(resp.Body).Decode(&conflict)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict || len(conflict.Reasons) == 0 {
+		t.Fatalf("expected 409 with reasons, got %d %+v", resp.StatusCode, conflict)
+	}
+
+	resp = register(`{"schema": {"type": "object", "required": ["action"], "properties": {"action": {"type": "string"}, "page": {"type": "string"}}}}`)
+	var created validator.SchemaVersion
+	_ = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || created.Version != 2 {
+		t.Fatalf("expected 201 with version 2, got %d %+v", resp.StatusCode, created)
+	}
+
+	resp, err = http.Get(ts.URL + "/schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list struct {
+		Types []api.SchemaTypeSummary `json:"types"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Types) != 1 || list.Types[0].Latest != 2 || len(list.Types[0].Versions) != 2 {
+		t.Fatalf("unexpected listing %+v", list.Types)
+	}
+
+	resp, err = http.Get(ts.URL + "/schemas/user_action/versions/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got validator.SchemaVersion
+	_ = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || got.Version != 1 {
+		t.Fatalf("expected version 1, got %d %+v", resp.StatusCode, got)
+	}
+
+	resp, err = http.Get(ts.URL + "/schemas/user_action/versions/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown version, got %d", resp.StatusCode)
+	}
+}
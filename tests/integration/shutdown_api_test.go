@@ -2,6 +2,7 @@ package integration
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"event-pipeline/internal/api"
 	"event-pipeline/internal/config"
@@ -14,7 +15,6 @@ import (
 	"time"
 )
 
-
 func setupShutdownServer() (*httptest.Server, *pipeline.EventPipeline, *testmocks.SlowStorage) {
 	metrics := pipeline.NewMetrics()
 	val := &validator.BasicValidator{}
@@ -49,11 +49,11 @@ func TestGracefulShutdownAPI(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer resp1.Body.Close()
-	var body1 map[string]bool
+	var body1 map[string]interface{}
 	if err := json.NewDecoder(resp1.Body).Decode(&body1); err != nil {
 		t.Fatal(err)
 	}
-	if !body1["healthy"] {
+	if body1["healthy"] != true {
 		t.Errorf("expected healthy=true before shutdown, got %v", body1["healthy"])
 	}
 
@@ -69,7 +69,7 @@ func TestGracefulShutdownAPI(t *testing.T) {
 	}
 
 	// trigger shutdown (should drain queue before exit)
-	p.Shutdown()
+	p.Shutdown(context.Background())
 
 	// wait for workers to finish processing all events
 	deadline := time.Now().Add(3 * time.Second)
@@ -95,12 +95,15 @@ func TestGracefulShutdownAPI(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer resp2.Body.Close()
-	var body2 map[string]bool
+	var body2 map[string]interface{}
 	if err := json.NewDecoder(resp2.Body).Decode(&body2); err != nil {
 		t.Fatal(err)
 	}
 
-	if body2["healthy"] {
-		t.Errorf("expected healthy=false after shutdown, got true")
+	if body2["healthy"] != false {
+		t.Errorf("expected healthy=false after shutdown, got %v", body2["healthy"])
+	}
+	if body2["state"] != "stopped" {
+		t.Errorf("expected state=stopped after shutdown, got %v", body2["state"])
 	}
 }
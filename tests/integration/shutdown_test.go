@@ -1,10 +1,13 @@
 package integration
 
 import (
+	"context"
+	"errors"
 	"event-pipeline/internal/config"
 	"event-pipeline/internal/pipeline"
 	"event-pipeline/pkg/validator"
 	"event-pipeline/tests/testmocks"
+	"sync"
 	"testing"
 	"time"
 )
@@ -26,7 +29,7 @@ func TestGracefulShutdownDrainsQueue(t *testing.T) {
 	}
 
 	// call shutdown (closes channel + cancels context)
-	p.Shutdown()
+	p.Shutdown(context.Background())
 
 	// wait until all events processed or timeout
 	deadline := time.Now().Add(2 * time.Second)
@@ -59,3 +62,118 @@ func TestGracefulShutdownDrainsQueue(t *testing.T) {
 		t.Error("expected EPS > 0")
 	}
 }
+
+func TestIngestAfterShutdownReturnsErrPipelineClosed(t *testing.T) {
+	storage := &testmocks.MockStorage{}
+	cfg := &config.Config{
+		WorkerCount:      2,
+		QueueSize:        100,
+		MaxRetries:       3,
+		RetryBaseBackoff: 20 * time.Millisecond,
+	}
+
+	p := pipeline.NewEventPipeline(storage, &testmocks.FastProcessor{}, &validator.BasicValidator{}, pipeline.NewMetrics(), cfg)
+	if p.State() != pipeline.StateRunning {
+		t.Fatalf("expected state running, got %s", p.State())
+	}
+
+	// concurrent producers racing with Shutdown must never panic
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				err := p.Ingest(pipeline.Event{Type: "user_action", Source: "web"})
+				if err != nil && !errors.Is(err, pipeline.ErrPipelineClosed) && !errors.Is(err, pipeline.ErrQueueFull) {
+					t.Errorf("unexpected ingest error: %v", err)
+				}
+			}
+		}()
+	}
+
+	p.Shutdown(context.Background())
+	p.Shutdown(context.Background()) // second call must be a no-op
+	wg.Wait()
+
+	if p.State() != pipeline.StateStopped {
+		t.Errorf("expected state stopped, got %s", p.State())
+	}
+	if err := p.Ingest(pipeline.Event{Type: "user_action", Source: "web"}); !errors.Is(err, pipeline.ErrPipelineClosed) {
+		t.Errorf("expected ErrPipelineClosed, got %v", err)
+	}
+}
+
+func TestShutdownDeadlineSpillsUndrainedEvents(t *testing.T) {
+	store := &testmocks.FlakyStorage{ShouldFail: 100} // database is down
+	spill := &testmocks.MockDeadLetterSink{}
+	metrics := pipeline.NewMetrics()
+	cfg := &config.Config{
+		WorkerCount:      1,
+		QueueSize:        100,
+		MaxRetries:       5,
+		RetryBaseBackoff: time.Second,
+	}
+
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, metrics, cfg,
+		pipeline.WithSpillSink(spill))
+
+	total := 5
+	for i := 0; i < total; i++ {
+		if err := p.Ingest(pipeline.Event{Type: "user_action", Source: "web"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	summary, err := p.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected shutdown to abort retry sleeps, took %v", elapsed)
+	}
+
+	if !summary.TimedOut {
+		t.Error("expected summary to report the timeout")
+	}
+	if summary.Spilled != total || summary.Drained != 0 || summary.Dropped != 0 {
+		t.Errorf("expected all %d events spilled, got %+v", total, summary)
+	}
+	for _, dl := range spill.All() {
+		if dl.Stage != pipeline.StageShutdown {
+			t.Errorf("expected stage %s, got %s", pipeline.StageShutdown, dl.Stage)
+		}
+	}
+	if metrics.GetFailed() != 0 {
+		t.Errorf("expected spilled events not to count as failed, got %d", metrics.GetFailed())
+	}
+}
+
+func TestShutdownSummaryReportsDrained(t *testing.T) {
+	cfg := &config.Config{
+		WorkerCount:      2,
+		QueueSize:        100,
+		MaxRetries:       3,
+		RetryBaseBackoff: 20 * time.Millisecond,
+	}
+	p := pipeline.NewEventPipeline(&testmocks.MockStorage{}, &testmocks.SlowProcessor{}, &validator.BasicValidator{}, pipeline.NewMetrics(), cfg)
+
+	for i := 0; i < 10; i++ {
+		_ = p.Ingest(pipeline.Event{Type: "user_action", Source: "web"})
+	}
+
+	summary, err := p.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Metrics().GetProcessed() != 10 || summary.Spilled != 0 || summary.TimedOut {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	if summary.Drained == 0 {
+		t.Error("expected queued events to be drained during shutdown")
+	}
+}
@@ -0,0 +1,79 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"event-pipeline/internal/api"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWorkersAdminAPI(t *testing.T) {
+	cfg := &config.Config{WorkerCount: 2, WorkersMin: 1, WorkersMax: 6, QueueSize: 10, MaxRetries: 1}
+	p := pipeline.NewEventPipeline(&mockStorage{}, &mockProcessor{}, &validator.BasicValidator{}, pipeline.NewMetrics(), cfg)
+	defer p.Shutdown(context.Background())
+
+	server := api.NewServer(p)
+	server.Autoscaler = pipeline.NewAutoscaler(p, pipeline.AutoscaleConfig{QueuePerWorker: 10})
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	post := func(body string) (int, api.WorkersResponse) {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/admin/workers", "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var state api.WorkersResponse
+		if resp.StatusCode == http.StatusOK {
+			_ = json.NewDecoder(resp.Body).Decode(&state)
+		}
+		return resp.StatusCode, state
+	}
+
+	resp, err := http.Get(ts.URL + "/admin/workers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state api.WorkersResponse
+	_ = json.NewDecoder(resp.Body).Decode(&state)
+	resp.Body.Close()
+	want := api.WorkersResponse{Workers: 2, Min: 1, Max: 6, Autoscale: api.AutoscaleOn}
+	if state != want {
+		t.Fatalf("GET = %+v, want %+v", state, want)
+	}
+
+	// a manual count pauses the autoscaler
+	status, state := post(`{"workers": 5}`)
+	if status != http.StatusOK || state.Workers != 5 || state.Autoscale != api.AutoscalePaused {
+		t.Errorf("resize = %d %+v", status, state)
+	}
+	if p.WorkerCount() != 5 {
+		t.Errorf("pipeline workers = %d, want 5", p.WorkerCount())
+	}
+
+	if status, _ := post(`{"workers": 7}`); status != http.StatusBadRequest {
+		t.Errorf("out of bounds resize status = %d, want 400", status)
+	}
+	if status, _ := post(`{}`); status != http.StatusBadRequest {
+		t.Errorf("empty body status = %d, want 400", status)
+	}
+
+	status, state = post(`{"workers": 3, "autoscale": true}`)
+	if status != http.StatusOK || state.Workers != 3 || state.Autoscale != api.AutoscaleOn {
+		t.Errorf("resize with autoscale = %d %+v", status, state)
+	}
+
+	server.Autoscaler = nil
+	if status, _ := post(`{"autoscale": false}`); status != http.StatusNotImplemented {
+		t.Errorf("toggle without autoscaler status = %d, want 501", status)
+	}
+}
@@ -109,3 +109,79 @@ func (p *FastProcessor) Process(ctx context.Context, e pipeline.Event) (*pipelin
 		ProcessedAt:      time.Now(),
 	}, nil
 }
+
+// --- Batch Storage ---
+// Records every Store call and reports events in FailIDs as a partial
+// failure through pipeline.BatchError.
+type BatchStorage struct {
+	mu      sync.Mutex
+	Batches [][]pipeline.ProcessedEvent
+	FailIDs map[string]bool
+}
+
+func (s *BatchStorage) Store(_ context.Context, events []pipeline.ProcessedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Batches = append(s.Batches, events)
+
+	failed := make(map[int]error)
+	for i, ev := range events {
+		if s.FailIDs[ev.ID] {
+			failed[i] = errors.New("forced failure for event " + ev.ID)
+		}
+	}
+	if len(failed) > 0 {
+		return &pipeline.BatchError{Failed: failed}
+	}
+	return nil
+}
+
+func (s *BatchStorage) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.Batches)
+}
+
+// --- Mock Dead Letter Sink ---
+type MockDeadLetterSink struct {
+	mu      sync.Mutex
+	Letters []pipeline.DeadLetter
+	Err     error // returned by every Write instead of recording
+}
+
+func (s *MockDeadLetterSink) Write(_ context.Context, letters []pipeline.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	s.Letters = append(s.Letters, letters...)
+	return nil
+}
+
+func (s *MockDeadLetterSink) All() []pipeline.DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]pipeline.DeadLetter(nil), s.Letters...)
+}
+
+// --- Blocking Storage ---
+// Blocks every Store call until Release is closed.
+type BlockingStorage struct {
+	Release chan struct{}
+	mu      sync.Mutex
+	Events  []pipeline.ProcessedEvent
+}
+
+func NewBlockingStorage() *BlockingStorage {
+	return &BlockingStorage{Release: make(chan struct{})}
+}
+
+func (s *BlockingStorage) Store(_ context.Context, events []pipeline.ProcessedEvent) error {
+	<-s.Release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Events = append(s.Events, events...)
+	return nil
+}
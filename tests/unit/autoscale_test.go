@@ -0,0 +1,117 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"fmt"
+	"testing"
+)
+
+func scalable(workers, min, max int) *config.Config {
+	return &config.Config{WorkerCount: workers, WorkersMin: min, WorkersMax: max, QueueSize: 50, MaxRetries: 1}
+}
+
+func scaleEvent(i int) pipeline.Event {
+	return pipeline.Event{Type: "user_action", Source: "unit", Data: map[string]interface{}{"name": fmt.Sprintf("ev-%d", i)}}
+}
+
+func TestSetWorkerCountStopsWorkersCleanly(t *testing.T) {
+	store := testmocks.NewBlockingStorage()
+	metrics := pipeline.NewMetrics()
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, metrics, scalable(2, 1, 4))
+
+	// both workers hold an event in Store
+	p.Ingest(scaleEvent(0))
+	p.Ingest(scaleEvent(1))
+	waitFor(t, func() bool { return p.QueueDepth() == 0 })
+
+	prev, err := p.SetWorkerCount(1)
+	if err != nil || prev != 2 || p.WorkerCount() != 1 {
+		t.Fatalf("shrink: prev = %d, workers = %d, err = %v", prev, p.WorkerCount(), err)
+	}
+	if _, err := p.SetWorkerCount(3); err != nil || p.WorkerCount() != 3 {
+		t.Fatalf("grow: workers = %d, err = %v", p.WorkerCount(), err)
+	}
+	for i := 2; i < 6; i++ {
+		p.Ingest(scaleEvent(i))
+	}
+
+	if _, err := p.SetWorkerCount(5); !errors.Is(err, pipeline.ErrWorkerBounds) {
+		t.Errorf("SetWorkerCount(5) err = %v, want ErrWorkerBounds", err)
+	}
+	if _, err := p.SetWorkerCount(0); !errors.Is(err, pipeline.ErrWorkerBounds) {
+		t.Errorf("SetWorkerCount(0) err = %v, want ErrWorkerBounds", err)
+	}
+
+	close(store.Release)
+	if _, err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the removed worker stored the event it held
+	if len(store.Events) != 6 || metrics.GetProcessed() != 6 {
+		t.Errorf("stored %d events, processed %d, want 6", len(store.Events), metrics.GetProcessed())
+	}
+	if _, err := p.SetWorkerCount(2); !errors.Is(err, pipeline.ErrPipelineClosed) {
+		t.Errorf("SetWorkerCount after shutdown err = %v, want ErrPipelineClosed", err)
+	}
+}
+
+func TestSetWorkerCountIsFixedWhenPartitioned(t *testing.T) {
+	p := pipeline.NewEventPipeline(&orderStorage{}, &testmocks.FastProcessor{}, &validator.BasicValidator{}, pipeline.NewMetrics(), partitioned(2))
+	defer p.Shutdown(context.Background())
+
+	if _, err := p.SetWorkerCount(3); !errors.Is(err, pipeline.ErrFixedWorkers) {
+		t.Errorf("err = %v, want ErrFixedWorkers", err)
+	}
+	if p.WorkerCount() != 2 {
+		t.Errorf("workers = %d, want 2", p.WorkerCount())
+	}
+}
+
+func TestAutoscalerFollowsQueueDepth(t *testing.T) {
+	store := testmocks.NewBlockingStorage()
+	metrics := pipeline.NewMetrics()
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, metrics, scalable(1, 1, 4))
+	a := pipeline.NewAutoscaler(p, pipeline.AutoscaleConfig{QueuePerWorker: 2})
+
+	if got := a.Step(); got != 1 {
+		t.Fatalf("idle step = %d, want 1", got)
+	}
+
+	for i := 0; i < 10; i++ {
+		p.Ingest(scaleEvent(i))
+	}
+	// every new worker picks up one event and blocks in Store
+	waitFor(t, func() bool { return p.QueueDepth() == 9 })
+	steps := []struct{ workers, depth int }{{2, 8}, {3, 7}, {4, 6}}
+	for _, s := range steps {
+		if got := a.Step(); got != s.workers {
+			t.Fatalf("step = %d, want %d", got, s.workers)
+		}
+		waitFor(t, func() bool { return p.QueueDepth() == s.depth })
+	}
+	// capped at WorkersMax
+	if got := a.Step(); got != 4 {
+		t.Fatalf("step at max = %d, want 4", got)
+	}
+
+	close(store.Release)
+	waitFor(t, func() bool { return metrics.GetProcessed() == 10 })
+	// one worker at a time back down to WorkersMin
+	for _, want := range []int{3, 2, 1, 1} {
+		if got := a.Step(); got != want {
+			t.Fatalf("idle step = %d, want %d", got, want)
+		}
+	}
+
+	if _, err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.Events) != 10 {
+		t.Errorf("stored %d events, want 10", len(store.Events))
+	}
+}
@@ -0,0 +1,103 @@
+package unit
+
+import (
+	"context"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBatchWriterFlushesOnSizeAndLinger(t *testing.T) {
+	store := &testmocks.BatchStorage{}
+	proc := &testmocks.FastProcessor{}
+	val := &validator.BasicValidator{}
+	metrics := pipeline.NewMetrics()
+
+	cfg := &config.Config{
+		WorkerCount:      2,
+		QueueSize:        100,
+		MaxRetries:       3,
+		RetryBaseBackoff: 10 * time.Millisecond,
+		BatchSize:        5,
+		BatchLinger:      50 * time.Millisecond,
+	}
+
+	p := pipeline.NewEventPipeline(store, proc, val, metrics, cfg)
+	defer p.Shutdown(context.Background())
+
+	// 12 events → two full batches plus a partial one flushed by linger
+	for i := 0; i < 12; i++ {
+		p.Ingest(pipeline.Event{Type: "user_action", Source: "web"})
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if metrics.GetProcessed() >= 12 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting, processed=%d batches=%d", metrics.GetProcessed(), store.Calls())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if store.Calls() >= 12 {
+		t.Errorf("expected events to be batched, got %d store calls", store.Calls())
+	}
+	for _, b := range store.Batches {
+		if len(b) > 5 {
+			t.Errorf("expected batches of at most 5 events, got %d", len(b))
+		}
+	}
+	if metrics.GetBatches() != uint64(store.Calls()) {
+		t.Errorf("expected batches metric=%d, got %d", store.Calls(), metrics.GetBatches())
+	}
+}
+
+func TestBatchWriterPartialFailure(t *testing.T) {
+	badID := uuid.New().String()
+	store := &testmocks.BatchStorage{FailIDs: map[string]bool{badID: true}}
+	proc := &testmocks.FastProcessor{}
+	val := &validator.BasicValidator{}
+	metrics := pipeline.NewMetrics()
+
+	cfg := &config.Config{
+		WorkerCount:      1,
+		QueueSize:        100,
+		MaxRetries:       3,
+		RetryBaseBackoff: 10 * time.Millisecond,
+		BatchSize:        10,
+		BatchLinger:      50 * time.Millisecond,
+	}
+
+	p := pipeline.NewEventPipeline(store, proc, val, metrics, cfg)
+
+	p.Ingest(pipeline.Event{Type: "user_action", Source: "web"})
+	p.Ingest(pipeline.Event{ID: badID, Type: "user_action", Source: "web"})
+	p.Ingest(pipeline.Event{Type: "user_action", Source: "web"})
+
+	// shutdown flushes the pending partial batch
+	p.Shutdown(context.Background())
+
+	if metrics.GetProcessed() != 2 {
+		t.Errorf("expected processed=2, got %d", metrics.GetProcessed())
+	}
+	if metrics.GetFailed() != 1 {
+		t.Errorf("expected failed=1, got %d", metrics.GetFailed())
+	}
+
+	// only the failing event is retried after the first attempt
+	for _, b := range store.Batches[1:] {
+		if len(b) != 1 || b[0].ID != badID {
+			t.Errorf("expected retries to carry only the failed event, got %d events", len(b))
+		}
+	}
+	if store.Calls() != 3 {
+		t.Errorf("expected 3 store calls, got %d", store.Calls())
+	}
+}
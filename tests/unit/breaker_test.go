@@ -0,0 +1,183 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/internal/storage"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"sync"
+	"testing"
+	"time"
+)
+
+// switchStorage fails every call with err until err is cleared.
+type switchStorage struct {
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func (s *switchStorage) Store(_ context.Context, _ []pipeline.ProcessedEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	return s.err
+}
+
+func (s *switchStorage) set(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+func (s *switchStorage) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestBreakerOpensFailsFastAndRecovers(t *testing.T) {
+	backend := &switchStorage{err: errors.New("connection refused")}
+	b := storage.NewBreaker("mysql", backend, storage.BreakerConfig{Failures: 3, OpenMS: 40})
+	metrics := pipeline.NewMetrics()
+	b.SetMetrics(metrics)
+	ev := []pipeline.ProcessedEvent{routed("a", "user_action", "web", nil)}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := b.Store(ctx, ev); err == nil || errors.Is(err, pipeline.ErrCircuitOpen) {
+			t.Fatalf("call %d: err = %v, want the backend error", i, err)
+		}
+	}
+	if b.State() != storage.BreakerOpen {
+		t.Fatalf("state = %s after 3 failures, want open", b.State())
+	}
+
+	// open: fails fast without calling the backend
+	if err := b.Store(ctx, ev); !errors.Is(err, pipeline.ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+	if backend.count() != 3 {
+		t.Errorf("backend calls = %d while open, want 3", backend.count())
+	}
+
+	// half-open: a failed trial reopens
+	time.Sleep(50 * time.Millisecond)
+	if b.State() != storage.BreakerHalfOpen {
+		t.Fatalf("state = %s after the timeout, want half_open", b.State())
+	}
+	if err := b.Store(ctx, ev); err == nil || errors.Is(err, pipeline.ErrCircuitOpen) {
+		t.Fatalf("trial err = %v, want the backend error", err)
+	}
+	if b.State() != storage.BreakerOpen {
+		t.Fatalf("state = %s after a failed trial, want open", b.State())
+	}
+
+	// a successful trial closes it
+	backend.set(nil)
+	time.Sleep(50 * time.Millisecond)
+	if err := b.Store(ctx, ev); err != nil {
+		t.Fatalf("trial err = %v", err)
+	}
+	if b.State() != storage.BreakerClosed {
+		t.Fatalf("state = %s after a good trial, want closed", b.State())
+	}
+
+	st := metrics.BreakerStats()["mysql"]
+	if st.State != storage.BreakerClosed || st.Trips != 2 || st.Rejected != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+
+	// per-event errors the backend answered with mean it is up
+	batch := []pipeline.ProcessedEvent{ev[0], routed("b", "user_action", "web", nil)}
+	backend.set(&pipeline.BatchError{Failed: map[int]error{0: errors.New("bad row")}})
+	for i := 0; i < 5; i++ {
+		_ = b.Store(ctx, batch)
+	}
+	backend.set(&pipeline.BatchError{Failed: map[int]error{0: pipeline.Permanent(errors.New("bad row")), 1: errors.New("connection reset")}})
+	for i := 0; i < 5; i++ {
+		_ = b.Store(ctx, batch)
+	}
+	if b.State() != storage.BreakerClosed {
+		t.Errorf("state = %s after batch errors, want closed", b.State())
+	}
+
+	// a batch where every event failed with a backend error is a failure
+	backend.set(&pipeline.BatchError{Failed: map[int]error{0: errors.New("connection reset"), 1: errors.New("connection reset")}})
+	for i := 0; i < 3; i++ {
+		_ = b.Store(ctx, batch)
+	}
+	if b.State() != storage.BreakerOpen {
+		t.Errorf("state = %s after failed batches, want open", b.State())
+	}
+}
+
+func TestBreakerIgnoresEmptyBatches(t *testing.T) {
+	// what a storage returns when nothing was left to store
+	backend := &switchStorage{err: &pipeline.BatchError{Failed: map[int]error{}}}
+	b := storage.NewBreaker("mysql", backend, storage.BreakerConfig{Failures: 1, OpenMS: 60000})
+
+	for i := 0; i < 3; i++ {
+		_ = b.Store(context.Background(), nil)
+	}
+	if b.State() != storage.BreakerClosed {
+		t.Errorf("state = %s after empty batches, want closed", b.State())
+	}
+}
+
+func TestBreakerSpoolsToFallbackWhileOpen(t *testing.T) {
+	backend := &switchStorage{err: errors.New("connection refused")}
+	spool := &testmocks.MockStorage{}
+	b := storage.NewBreaker("mysql", backend, storage.BreakerConfig{Failures: 1, OpenMS: 60000})
+	b.SetFallback(spool)
+	metrics := pipeline.NewMetrics()
+	b.SetMetrics(metrics)
+
+	ctx := context.Background()
+	if err := b.Store(ctx, []pipeline.ProcessedEvent{routed("a", "user_action", "web", nil)}); err == nil {
+		t.Fatal("first call succeeded, want the backend error")
+	}
+	if err := b.Store(ctx, []pipeline.ProcessedEvent{routed("b", "user_action", "web", nil), routed("c", "user_action", "web", nil)}); err != nil {
+		t.Fatalf("spooled call err = %v", err)
+	}
+	if got := storedIDs(spool); len(got) != 2 || got["b"] != 1 || got["c"] != 1 {
+		t.Errorf("spool got %v, want b and c", got)
+	}
+	if st := metrics.BreakerStats()["mysql"]; st.State != storage.BreakerOpen || st.Fallback != 2 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestPipelineRetriesOnceCircuitHalfOpens(t *testing.T) {
+	backend := &switchStorage{err: errors.New("connection refused")}
+	b := storage.NewBreaker("mysql", backend, storage.BreakerConfig{Failures: 1, OpenMS: 100})
+	dlq := &testmocks.MockDeadLetterSink{}
+	metrics := pipeline.NewMetrics()
+	cfg := &config.Config{
+		WorkerCount:      1,
+		QueueSize:        10,
+		MaxRetries:       3,
+		RetryBaseBackoff: time.Millisecond,
+	}
+	p := pipeline.NewEventPipeline(b, &pipeline.JSONProcessor{}, &validator.BasicValidator{}, metrics, cfg,
+		pipeline.WithDeadLetterSink(dlq))
+	defer p.Shutdown(context.Background())
+
+	// the first attempt trips the breaker, the next is rejected and waits
+	// for the open timeout instead of burning the remaining attempts
+	start := time.Now()
+	p.Ingest(pipeline.Event{Type: "user_action", Source: "unit"})
+	waitFor(t, func() bool { return metrics.GetRetries() == 2 })
+	backend.set(nil)
+	waitFor(t, func() bool { return metrics.GetProcessed() == 1 })
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("stored after %s, before the breaker let trial calls through", elapsed)
+	}
+	if backend.count() != 2 || metrics.GetFailed() != 0 || len(dlq.All()) != 0 {
+		t.Errorf("backend calls = %d, failed = %d, dead letters = %d", backend.count(), metrics.GetFailed(), len(dlq.All()))
+	}
+}
@@ -0,0 +1,179 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func setField(key string, value interface{}) pipeline.Stage {
+	return pipeline.StageFunc(func(_ context.Context, ev pipeline.Event) ([]pipeline.Event, error) {
+		data := map[string]interface{}{key: value}
+		for k, v := range ev.Data {
+			data[k] = v
+		}
+		ev.Data = data
+		return []pipeline.Event{ev}, nil
+	})
+}
+
+func failing(msg string) pipeline.Stage {
+	return pipeline.StageFunc(func(context.Context, pipeline.Event) ([]pipeline.Event, error) {
+		return nil, errors.New(msg)
+	})
+}
+
+// splitReadings fans a sensor event out into one event per reading.
+var splitReadings = pipeline.StageFunc(func(_ context.Context, ev pipeline.Event) ([]pipeline.Event, error) {
+	readings, _ := ev.Data["readings"].([]interface{})
+	out := make([]pipeline.Event, 0, len(readings))
+	for _, r := range readings {
+		e := ev
+		e.Data = map[string]interface{}{"reading": r}
+		out = append(out, e)
+	}
+	return out, nil
+})
+
+func TestProcessorChainTransformsFiltersAndFansOut(t *testing.T) {
+	metrics := pipeline.NewMetrics()
+	chain := pipeline.NewProcessorChain(
+		pipeline.ChainStage{Name: "tag", Stage: setField("pipeline", "v2")},
+		pipeline.ChainStage{Name: "split", Stage: splitReadings},
+		pipeline.ChainStage{Name: "passthrough", Stage: pipeline.ProcessorStage(&pipeline.JSONProcessor{})},
+	)
+	chain.SetMetrics(metrics)
+
+	ev := pipeline.NewEvent(pipeline.Event{
+		Type:   "sensor_data",
+		Source: "iot",
+		Data:   map[string]interface{}{"readings": []interface{}{1.0, 2.0, 3.0}},
+	})
+	out, err := chain.ProcessAll(context.Background(), ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 {
+		t.Fatalf("expected 3 fanned-out events, got %d", len(out))
+	}
+
+	ids := map[string]bool{}
+	for _, pe := range out {
+		ids[pe.ID] = true
+		if pe.ProcessedAt.IsZero() {
+			t.Error("expected ProcessedAt to be set")
+		}
+	}
+	if len(ids) != 3 || !ids[ev.ID] {
+		t.Errorf("expected distinct IDs keeping the original first, got %v", ids)
+	}
+
+	// derived IDs are stable across runs
+	again, _ := chain.ProcessAll(context.Background(), ev)
+	for i := range out {
+		if out[i].ID != again[i].ID {
+			t.Errorf("expected deterministic ID for output %d", i)
+		}
+	}
+
+	empty := ev
+	empty.Data = map[string]interface{}{}
+	if _, err := chain.Process(context.Background(), empty); !errors.Is(err, pipeline.ErrEventDropped) {
+		t.Errorf("expected ErrEventDropped, got %v", err)
+	}
+
+	stats := metrics.StageStats()
+	if stats["tag"].Calls != 3 || stats["split"].Dropped != 1 || stats["passthrough"].Calls != 6 {
+		t.Errorf("unexpected stage stats %+v", stats)
+	}
+}
+
+func TestProcessorChainErrorPolicies(t *testing.T) {
+	ev := pipeline.NewEvent(pipeline.Event{Type: "user_action", Source: "web", Data: map[string]interface{}{}})
+
+	skip := pipeline.NewProcessorChain(
+		pipeline.ChainStage{Name: "geo", Stage: failing("lookup down"), OnError: pipeline.PolicySkip},
+		pipeline.ChainStage{Name: "tag", Stage: setField("tagged", true)},
+	)
+	out, err := skip.ProcessAll(context.Background(), ev)
+	if err != nil || len(out) != 1 || out[0].Data["tagged"] != true {
+		t.Fatalf("expected skipped stage to pass the event on, got %v %v", out, err)
+	}
+
+	for _, policy := range []pipeline.ErrorPolicy{pipeline.PolicyFail, ""} {
+		chain := pipeline.NewProcessorChain(pipeline.ChainStage{Name: "geo", Stage: failing("lookup down"), OnError: policy})
+		_, err := chain.ProcessAll(context.Background(), ev)
+		var serr *pipeline.StageError
+		if !errors.As(err, &serr) || serr.Stage != "geo" {
+			t.Fatalf("expected StageError from geo, got %v", err)
+		}
+		want := policy
+		if want == "" {
+			want = pipeline.PolicyDeadLetter
+		}
+		if serr.Policy != want {
+			t.Errorf("expected policy %q, got %q", want, serr.Policy)
+		}
+	}
+}
+
+func TestPipelineStoresFanOutAndAcksWAL(t *testing.T) {
+	wal, err := pipeline.OpenWAL(t.TempDir(), 1<<20, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	store := &testmocks.BatchStorage{}
+	dlq := &testmocks.MockDeadLetterSink{}
+	metrics := pipeline.NewMetrics()
+	chain := pipeline.NewProcessorChain(
+		pipeline.ChainStage{Name: "split", Stage: splitReadings},
+		pipeline.ChainStage{Name: "strict", Stage: failing("rejected"), OnError: pipeline.PolicyFail},
+	)
+	chain.SetMetrics(metrics)
+	cfg := &config.Config{WorkerCount: 1, QueueSize: 10, MaxRetries: 1, RetryBaseBackoff: time.Millisecond}
+
+	// the strict stage fails every event: discarded, not dead-lettered
+	p := pipeline.NewEventPipeline(store, chain, &validator.BasicValidator{}, metrics, cfg,
+		pipeline.WithWAL(wal), pipeline.WithDeadLetterSink(dlq))
+	_ = p.Ingest(pipeline.Event{Type: "sensor_data", Source: "iot", Data: map[string]interface{}{"readings": []interface{}{1.0}}})
+	waitFor(t, func() bool { return metrics.GetFailed() == 1 })
+	p.Shutdown(context.Background())
+	if len(dlq.All()) != 0 || wal.Unacked() != 0 {
+		t.Fatalf("expected discarded event without dead letter, got %d letters, %d unacked", len(dlq.All()), wal.Unacked())
+	}
+
+	// a pass-through chain after the split stores every reading
+	chain = pipeline.NewProcessorChain(pipeline.ChainStage{Name: "split", Stage: splitReadings})
+	store.FailIDs = map[string]bool{}
+	p = pipeline.NewEventPipeline(store, chain, &validator.BasicValidator{}, metrics, cfg, pipeline.WithWAL(wal))
+	defer p.Shutdown(context.Background())
+
+	id := uuid.New().String()
+	_ = p.Ingest(pipeline.Event{ID: id, Type: "sensor_data", Source: "iot", Data: map[string]interface{}{"readings": []interface{}{1.0, 2.0, 3.0}}})
+	_ = p.Ingest(pipeline.Event{Type: "sensor_data", Source: "iot", Data: map[string]interface{}{}})
+	waitFor(t, func() bool { return metrics.GetProcessed() == 3 && metrics.GetFiltered() == 1 })
+
+	if wal.Unacked() != 0 {
+		t.Errorf("expected the WAL entry to be acked after all outputs, got %d unacked", wal.Unacked())
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,97 @@
+package unit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/internal/storage"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterOnValidationAndStorageFailure(t *testing.T) {
+	store := &testmocks.FlakyStorage{ShouldFail: 5} // always fail
+	proc := &testmocks.DummyProcessor{}
+	val := &validator.BasicValidator{}
+	metrics := pipeline.NewMetrics()
+	dlq := &testmocks.MockDeadLetterSink{}
+
+	cfg := &config.Config{
+		WorkerCount:      1,
+		QueueSize:        100,
+		MaxRetries:       3,
+		RetryBaseBackoff: 10 * time.Millisecond,
+	}
+
+	p := pipeline.NewEventPipeline(store, proc, val, metrics, cfg, pipeline.WithDeadLetterSink(dlq))
+
+	p.Ingest(pipeline.Event{Source: "web"}) // invalid: missing type
+	p.Ingest(pipeline.Event{Type: "user_action", Source: "web"})
+	p.Shutdown(context.Background())
+
+	letters := dlq.All()
+	if len(letters) != 2 {
+		t.Fatalf("expected 2 dead letters, got %d", len(letters))
+	}
+	if letters[0].Stage != pipeline.StageValidation || letters[0].Attempts != 1 {
+		t.Errorf("expected validation dead letter with 1 attempt, got %s/%d", letters[0].Stage, letters[0].Attempts)
+	}
+	if letters[1].Stage != pipeline.StageStorage || letters[1].Attempts != 3 {
+		t.Errorf("expected storage dead letter with 3 attempts, got %s/%d", letters[1].Stage, letters[1].Attempts)
+	}
+	if letters[1].Error == "" || letters[1].FailedAt.IsZero() {
+		t.Error("expected error text and failure time to be recorded")
+	}
+	if metrics.GetDeadLettered() != 2 {
+		t.Errorf("expected dead_lettered=2, got %d", metrics.GetDeadLettered())
+	}
+}
+
+func TestFileDeadLetterSinkWritesJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dlq.jsonl")
+	sink, err := storage.NewFileDeadLetterSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	letters := []pipeline.DeadLetter{
+		{Event: pipeline.NewEvent(pipeline.Event{Type: "user_action", Source: "web"}), Stage: pipeline.StageProcessing, Error: errors.New("boom").Error(), Attempts: 1, FailedAt: time.Now()},
+		{Event: pipeline.NewEvent(pipeline.Event{Type: "system_log", Source: "api"}), Stage: pipeline.StageStorage, Error: "db down", Attempts: 3, FailedAt: time.Now()},
+	}
+	if err := sink.Write(context.Background(), letters); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var got []pipeline.DeadLetter
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var dl pipeline.DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &dl); err != nil {
+			t.Fatalf("invalid JSON line: %v", err)
+		}
+		got = append(got, dl)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(got))
+	}
+	if got[1].Event.ID != letters[1].Event.ID || got[1].Stage != pipeline.StageStorage {
+		t.Errorf("unexpected dead letter: %+v", got[1])
+	}
+}
@@ -0,0 +1,81 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDedupCacheTTLAndBound(t *testing.T) {
+	c := pipeline.NewDedupCache(50*time.Millisecond, 2)
+
+	if c.Seen("a") {
+		t.Error("expected first sighting of a to be new")
+	}
+	if !c.Seen("a") {
+		t.Error("expected a to be a duplicate within the TTL")
+	}
+
+	// bound: adding b and c evicts the oldest key
+	c.Seen("b")
+	c.Seen("c")
+	if c.Len() != 2 {
+		t.Errorf("expected cache bounded to 2 keys, got %d", c.Len())
+	}
+	if c.Seen("a") {
+		t.Error("expected a to have been evicted")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if c.Seen("c") {
+		t.Error("expected c to have expired")
+	}
+
+	c.Forget("c")
+	if c.Seen("c") {
+		t.Error("expected forgotten key to be new")
+	}
+}
+
+func TestIngestDropsDuplicateIDs(t *testing.T) {
+	store := &testmocks.MockStorage{}
+	metrics := pipeline.NewMetrics()
+	cfg := &config.Config{
+		WorkerCount:      1,
+		QueueSize:        100,
+		MaxRetries:       3,
+		RetryBaseBackoff: 10 * time.Millisecond,
+		DedupTTL:         time.Minute,
+		DedupMaxKeys:     100,
+	}
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, metrics, cfg)
+
+	id := uuid.New().String()
+	if err := p.Ingest(pipeline.Event{ID: id, Type: "user_action", Source: "web"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Ingest(pipeline.Event{ID: id, Type: "user_action", Source: "web"}); !errors.Is(err, pipeline.ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate, got %v", err)
+	}
+	// events without an ID are never duplicates
+	for i := 0; i < 2; i++ {
+		if err := p.Ingest(pipeline.Event{Type: "user_action", Source: "web"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Shutdown(context.Background())
+
+	if len(store.Events) != 3 {
+		t.Errorf("expected 3 events stored, got %d", len(store.Events))
+	}
+	if metrics.GetDuplicates() != 1 {
+		t.Errorf("expected duplicates=1, got %d", metrics.GetDuplicates())
+	}
+}
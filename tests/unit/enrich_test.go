@@ -0,0 +1,198 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/processor"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+// countingTable is a lookup table that counts how often it is queried.
+type countingTable struct {
+	rows  map[string]map[string]interface{}
+	err   error
+	calls int32
+}
+
+func (t *countingTable) Lookup(ctx context.Context, key string) (map[string]interface{}, bool, error) {
+	atomic.AddInt32(&t.calls, 1)
+	if t.err != nil {
+		return nil, false, t.err
+	}
+	row, ok := t.rows[key]
+	return row, ok, nil
+}
+
+func TestFileTablesLoadCSVAndJSON(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "devices.csv")
+	if err := os.WriteFile(csvPath, []byte("model,device_id,site\nTH-200,dev-1,berlin\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	devices, err := processor.LoadFileTable(csvPath, "device_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, ok, _ := devices.Lookup(context.Background(), "dev-1")
+	if !ok || !reflect.DeepEqual(row, map[string]interface{}{"model": "TH-200", "site": "berlin"}) {
+		t.Fatalf("csv row = %v, %v", row, ok)
+	}
+
+	keyed := filepath.Join(dir, "users.json")
+	if err := os.WriteFile(keyed, []byte(`{"u1": {"tier": "gold"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	users, err := processor.LoadFileTable(keyed, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row, ok, _ := users.Lookup(context.Background(), "u1"); !ok || row["tier"] != "gold" {
+		t.Fatalf("json object row = %v, %v", row, ok)
+	}
+
+	array := filepath.Join(dir, "geo.json")
+	if err := os.WriteFile(array, []byte(`[{"code": 49, "country": "DE"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	geo, err := processor.LoadFileTable(array, "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row, ok, _ := geo.Lookup(context.Background(), "49"); !ok || !reflect.DeepEqual(row, map[string]interface{}{"country": "DE"}) {
+		t.Fatalf("json array row = %v, %v", row, ok)
+	}
+
+	// a broken file keeps the previous rows
+	if err := os.WriteFile(keyed, []byte(`{`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Reload(); err == nil {
+		t.Fatal("Reload of a broken file succeeded")
+	}
+	if users.Len() != 1 {
+		t.Errorf("Len() = %d after failed reload, want 1", users.Len())
+	}
+
+	if _, err := processor.LoadFileTable(array, ""); err == nil {
+		t.Error("array table without key_column loaded, want an error")
+	}
+	if _, err := processor.LoadFileTable(csvPath, "serial"); err == nil {
+		t.Error("csv table with unknown key column loaded, want an error")
+	}
+}
+
+func TestEnricherMergesCachesAndCounts(t *testing.T) {
+	users := &countingTable{rows: map[string]map[string]interface{}{
+		"u1": {"tier": "gold", "country": "DE", "internal": "x"},
+	}}
+	devices := &countingTable{rows: map[string]map[string]interface{}{
+		"dev-1": {"site": "berlin"},
+	}}
+	en, err := processor.NewEnricherWithTables(processor.EnrichConfig{
+		Lookups: []processor.LookupConfig{
+			{Name: "users", Key: "user_id", Fields: []string{"tier", "country"}, Target: "user"},
+			{Name: "devices", Key: "data.device_id", Types: []string{"sensor_data"}, Required: true},
+		},
+	}, map[string]processor.LookupTable{"users": users, "devices": devices})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := pipeline.NewMetrics()
+	en.SetMetrics(metrics)
+
+	in := pipeline.Event{
+		Type:   "sensor_data",
+		UserID: "u1",
+		Data: map[string]interface{}{
+			"device_id": "dev-1",
+			"user":      map[string]interface{}{"country": "FR"},
+		},
+	}
+	out, err := en.Apply(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"device_id": "dev-1",
+		"site":      "berlin",
+		"user":      map[string]interface{}{"country": "FR", "tier": "gold"},
+	}
+	if !reflect.DeepEqual(out[0].Data, want) {
+		t.Fatalf("data = %v, want %v", out[0].Data, want)
+	}
+	if _, ok := in.Data["site"]; ok {
+		t.Error("enricher modified the input event")
+	}
+
+	// the second event is served from the cache, missing keys included
+	if _, err := en.Apply(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := en.Apply(context.Background(), pipeline.Event{Type: "user_action", UserID: "u9"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if users.calls != 2 || devices.calls != 1 {
+		t.Errorf("table calls = users %d, devices %d; want 2 and 1", users.calls, devices.calls)
+	}
+
+	// a required key that is missing is an error
+	_, err = en.Apply(context.Background(), pipeline.Event{Type: "sensor_data", Data: map[string]interface{}{"device_id": "dev-9"}})
+	if err == nil {
+		t.Fatal("missing required key succeeded, want an error")
+	}
+
+	stats := metrics.LookupStats()
+	if got := stats["users"]; got.Lookups != 4 || got.CacheHits != 2 || got.MissingKeys != 2 || got.HitRate != 0.5 {
+		t.Errorf("users stats = %+v", got)
+	}
+	if got := stats["devices"]; got.Lookups != 3 || got.CacheHits != 1 || got.MissingKeys != 1 {
+		t.Errorf("devices stats = %+v", got)
+	}
+
+	// Reload empties the caches
+	if err := en.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := en.Apply(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+	if users.calls != 3 {
+		t.Errorf("users calls after reload = %d, want 3", users.calls)
+	}
+
+	// table errors are not cached
+	broken := &countingTable{err: errors.New("db down")}
+	en, err = processor.NewEnricherWithTables(processor.EnrichConfig{
+		Lookups: []processor.LookupConfig{{Name: "users", Key: "user_id"}},
+	}, map[string]processor.LookupTable{"users": broken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	en.SetMetrics(metrics)
+	for i := 0; i < 2; i++ {
+		if _, err := en.Apply(context.Background(), pipeline.Event{UserID: "u1"}); err == nil {
+			t.Fatal("lookup error was not returned")
+		}
+	}
+	if broken.calls != 2 {
+		t.Errorf("broken table calls = %d, want 2", broken.calls)
+	}
+
+	if _, err := processor.NewEnricherWithTables(processor.EnrichConfig{
+		Lookups: []processor.LookupConfig{{Name: "users", Key: "email"}},
+	}, map[string]processor.LookupTable{"users": users}); err == nil {
+		t.Error("invalid key accepted")
+	}
+	if _, err := processor.NewEnricher(processor.EnrichConfig{
+		Lookups: []processor.LookupConfig{{Name: "users", Key: "user_id", Table: "users; DROP", KeyColumn: "id"}},
+	}, nil); err == nil {
+		t.Error("table lookup without a database accepted")
+	}
+}
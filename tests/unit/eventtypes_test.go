@@ -0,0 +1,41 @@
+package unit
+
+import (
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/internal/storage"
+	"reflect"
+	"testing"
+)
+
+func TestEventTypesRegistry(t *testing.T) {
+	types := pipeline.NewEventTypes("sensor_data", "user_action", "")
+
+	if !types.Allowed("sensor_data") || types.Allowed("purchase") || types.Allowed("") {
+		t.Fatalf("unexpected allowed set %v", types.List())
+	}
+
+	types.Set([]string{"purchase"})
+	if !reflect.DeepEqual(types.List(), []string{"purchase"}) {
+		t.Fatalf("expected Set to replace the types, got %v", types.List())
+	}
+}
+
+func TestParseEnumValues(t *testing.T) {
+	cases := []struct {
+		column string
+		want   []string
+		ok     bool
+	}{
+		{"enum('user_action','sensor_data','system_log')", []string{"user_action", "sensor_data", "system_log"}, true},
+		{"ENUM('a', 'it''s')", []string{"a", "it's"}, true},
+		{"varchar(50)", nil, false},
+		{"enum('broken)", nil, false},
+	}
+
+	for _, c := range cases {
+		got, ok := storage.ParseEnumValues(c.column)
+		if ok != c.ok || (ok && !reflect.DeepEqual(got, c.want)) {
+			t.Errorf("ParseEnumValues(%q) = %v, %v; want %v, %v", c.column, got, ok, c.want, c.ok)
+		}
+	}
+}
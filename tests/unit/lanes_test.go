@@ -0,0 +1,112 @@
+package unit
+
+import (
+	"context"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func laneEvent(name, typ, priority string) pipeline.Event {
+	return pipeline.Event{Type: typ, Source: "unit", Priority: priority, Data: map[string]interface{}{"name": name}}
+}
+
+func TestLanesRouteAndShareWorkersByWeight(t *testing.T) {
+	store := testmocks.NewBlockingStorage()
+	metrics := pipeline.NewMetrics()
+	cfg := &config.Config{WorkerCount: 1, QueueSize: 20, MaxRetries: 1}
+	lanes := &pipeline.LanesConfig{
+		Lanes: []pipeline.LaneConfig{
+			{Name: "critical", Weight: 3, Types: []string{"system_log"}, Priorities: []string{"high"}},
+			{Name: "bulk", Weight: 1, Types: []string{"sensor_data"}},
+			{Name: "default"},
+		},
+		Default: "default",
+	}
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, metrics, cfg,
+		pipeline.WithLanes(lanes))
+
+	// park the only worker in Store, then let the dispatcher pick up a
+	// bulk event so the lanes below fill up untouched
+	p.Ingest(laneEvent("warmup", "user_action", ""))
+	waitFor(t, func() bool { return p.QueueDepth() == 0 })
+	p.Ingest(laneEvent("bulk-0", "sensor_data", ""))
+	waitFor(t, func() bool { return p.QueueDepth() == 0 })
+
+	for i := 1; i <= 8; i++ {
+		p.Ingest(laneEvent(fmt.Sprintf("bulk-%d", i), "sensor_data", ""))
+	}
+	for i := 0; i < 3; i++ {
+		p.Ingest(laneEvent(fmt.Sprintf("critical-%d", i), "system_log", ""))
+	}
+	// an explicit priority beats the type
+	p.Ingest(laneEvent("critical-3", "sensor_data", "high"))
+
+	stats := p.LaneStats()
+	if stats["critical"].Depth != 4 || stats["bulk"].Depth != 8 || stats["default"].Depth != 0 {
+		t.Fatalf("lane stats = %+v", stats)
+	}
+	if p.QueueDepth() != 12 {
+		t.Errorf("queue depth = %d, want 12", p.QueueDepth())
+	}
+
+	close(store.Release)
+	if _, err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	for _, ev := range store.Events {
+		order = append(order, ev.Data["name"].(string))
+	}
+	if len(order) != 14 || order[0] != "warmup" || order[1] != "bulk-0" {
+		t.Fatalf("stored %v", order)
+	}
+	// weight 3:1 while both lanes are backlogged: critical drains first,
+	// without starving bulk
+	next := order[2:7]
+	critical := 0
+	for _, id := range next {
+		if strings.HasPrefix(id, "critical") {
+			critical++
+		}
+	}
+	if critical != 4 {
+		t.Errorf("first picks after the backlog built up = %v, want all 4 critical and 1 bulk", next)
+	}
+	if st := p.LaneStats()["critical"]; st.Dequeued != 4 || st.Depth != 0 {
+		t.Errorf("critical lane stats = %+v", st)
+	}
+}
+
+func TestLoadLanesConfigRejectsBadLanes(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string]string{
+		"empty":     `{"lanes": []}`,
+		"duplicate": `{"lanes": [{"name": "a"}, {"name": "a"}]}`,
+		"default":   `{"lanes": [{"name": "a"}], "default": "b"}`,
+		"unknown":   `{"lanes": [{"name": "a", "wieght": 2}]}`,
+	}
+	for name, body := range cases {
+		path := filepath.Join(dir, name+".json")
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pipeline.LoadLanesConfig(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	path := filepath.Join(dir, "ok.json")
+	os.WriteFile(path, []byte(`{"lanes": [{"name": "fast", "weight": 4}, {"name": "slow"}]}`), 0o644)
+	cfg, err := pipeline.LoadLanesConfig(path)
+	if err != nil || len(cfg.Lanes) != 2 || cfg.Lanes[0].Weight != 4 {
+		t.Errorf("cfg = %+v, err = %v", cfg, err)
+	}
+}
@@ -0,0 +1,135 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// orderStorage records the order events are stored in, after a random
+// delay so workers overtake each other. failOnce fails the first attempt
+// for the listed sequence numbers.
+type orderStorage struct {
+	mu       sync.Mutex
+	stored   map[string][]int
+	failOnce map[int]bool
+}
+
+func (s *orderStorage) Store(_ context.Context, events []pipeline.ProcessedEvent) error {
+	time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ev := range events {
+		seq := int(ev.Data["seq"].(float64))
+		if s.failOnce[seq] {
+			delete(s.failOnce, seq)
+			return errors.New("connection reset")
+		}
+		if s.stored == nil {
+			s.stored = make(map[string][]int)
+		}
+		s.stored[ev.UserID] = append(s.stored[ev.UserID], seq)
+	}
+	return nil
+}
+
+func partitioned(workers int) *config.Config {
+	return &config.Config{
+		WorkerCount:      workers,
+		QueueSize:        400,
+		MaxRetries:       3,
+		RetryBaseBackoff: 5 * time.Millisecond,
+		PartitionKey:     "user_id",
+	}
+}
+
+func TestPartitionedModeKeepsPerKeyOrder(t *testing.T) {
+	// BATCH_SIZE does not apply: a shared batch would mix partitions
+	for _, batch := range []int{1, 10} {
+		t.Run(fmt.Sprintf("batch_size=%d", batch), func(t *testing.T) {
+			cfg := partitioned(4)
+			cfg.BatchSize = batch
+			checkPerKeyOrder(t, cfg)
+		})
+	}
+}
+
+func checkPerKeyOrder(t *testing.T, cfg *config.Config) {
+	store := &orderStorage{failOnce: map[int]bool{3: true, 42: true}}
+	metrics := pipeline.NewMetrics()
+	p := pipeline.NewEventPipeline(store, &pipeline.JSONProcessor{}, &validator.BasicValidator{}, metrics, cfg)
+
+	users := []string{"alice", "bob", "carol", "dave", "erin", "frank"}
+	for seq := 0; seq < 120; seq++ {
+		ev := pipeline.Event{
+			Type:   "user_action",
+			Source: "unit",
+			UserID: users[seq%len(users)],
+			Data:   map[string]interface{}{"seq": float64(seq)},
+		}
+		if err := p.Ingest(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if metrics.GetProcessed() != 120 || metrics.GetRetries() != 2 {
+		t.Fatalf("processed = %d, retries = %d", metrics.GetProcessed(), metrics.GetRetries())
+	}
+	// a failed event is retried before the next one for its key is stored
+	for user, seqs := range store.stored {
+		for i := 1; i < len(seqs); i++ {
+			if seqs[i] < seqs[i-1] {
+				t.Errorf("%s stored out of order: %v", user, seqs)
+				break
+			}
+		}
+	}
+}
+
+func TestPartitionedModeHashesByDataField(t *testing.T) {
+	store := testmocks.NewBlockingStorage()
+	cfg := partitioned(4)
+	cfg.PartitionKey = "data.device.id"
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, pipeline.NewMetrics(), cfg)
+
+	for i := 0; i < 5; i++ {
+		p.Ingest(pipeline.Event{
+			Type:   "sensor_data",
+			Source: "unit",
+			Data:   map[string]interface{}{"device": map[string]interface{}{"id": "dev-7"}},
+		})
+	}
+
+	// one worker holds the first event, the rest wait in the same partition
+	waitFor(t, func() bool { return p.QueueDepth() == 4 })
+	depths := p.PartitionDepths()
+	busy := 0
+	for _, d := range depths {
+		if d > 0 {
+			busy++
+		}
+	}
+	if len(depths) != 4 || busy != 1 {
+		t.Errorf("partition depths = %v, want all events in one partition", depths)
+	}
+
+	close(store.Release)
+	p.Shutdown(context.Background())
+	if got := len(store.Events); got != 5 {
+		t.Errorf("stored %d events, want 5", got)
+	}
+	if fmt.Sprint(p.PartitionDepths()) != "[0 0 0 0]" {
+		t.Errorf("partition depths after shutdown = %v", p.PartitionDepths())
+	}
+}
@@ -1,6 +1,7 @@
 package unit
 
 import (
+	"context"
 	"event-pipeline/internal/config"
 	"event-pipeline/internal/pipeline"
 	"event-pipeline/pkg/validator"
@@ -23,7 +24,7 @@ func TestWorkerPoolProcessing(t *testing.T) {
 	}
 
 	p := pipeline.NewEventPipeline(storage, processor, val, metrics, cfg)
-	defer p.Shutdown()
+	defer p.Shutdown(context.Background())
 
 	for i := 0; i < 20; i++ {
 		p.Ingest(pipeline.Event{Type: "user_action", Source: "web"})
@@ -68,7 +69,7 @@ func TestEventValidationFailure(t *testing.T) {
 	}
 
 	p := pipeline.NewEventPipeline(storage, processor, val, metrics, cfg)
-	defer p.Shutdown()
+	defer p.Shutdown(context.Background())
 
 	p.Ingest(pipeline.Event{Source: "web"}) // invalid event
 
@@ -96,7 +97,7 @@ func TestPipelineRetryAndFailureMetrics_FailAllRetries(t *testing.T) {
 	}
 
 	p := pipeline.NewEventPipeline(store, proc, val, metrics, cfg)
-	defer p.Shutdown()
+	defer p.Shutdown(context.Background())
 
 	p.Ingest(pipeline.Event{Type: "user_action", Source: "web"})
 
@@ -137,7 +138,7 @@ func TestPipelineRetryAndSuccessAfterRetries(t *testing.T) {
 	}
 
 	p := pipeline.NewEventPipeline(store, proc, val, metrics, cfg)
-	defer p.Shutdown()
+	defer p.Shutdown(context.Background())
 
 	p.Ingest(pipeline.Event{Type: "system_log", Source: "unit"})
 
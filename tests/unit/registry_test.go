@@ -0,0 +1,118 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"testing"
+)
+
+const sensorV1 = `{
+	"type": "object",
+	"required": ["temperature"],
+	"properties": {"temperature": {"type": "number", "minimum": -50}}
+}`
+
+func TestRegistryRegistersVersionsAndReloads(t *testing.T) {
+	dir := t.TempDir()
+	writeSchema(t, dir, "sensor_data", sensorV1)
+
+	r, err := validator.NewRegistry(dir, validator.CompatBackward)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// adding an optional property and loosening a bound is backward compatible
+	v, err := r.Register("sensor_data", []byte(`{
+		"type": "object",
+		"required": ["temperature"],
+		"properties": {
+			"temperature": {"type": "number", "minimum": -100},
+			"unit": {"type": "string"}
+		}
+	}`), "")
+	if err != nil {
+		t.Fatalf("expected compatible schema to register, got %v", err)
+	}
+	if v.Version != 2 {
+		t.Fatalf("expected version 2, got %d", v.Version)
+	}
+
+	reloaded, err := validator.NewRegistry(dir, validator.CompatBackward)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := reloaded.Versions("sensor_data")
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("expected 2 versions after reload, got %v (%v)", versions, err)
+	}
+}
+
+func TestRegistryRejectsIncompatibleSchema(t *testing.T) {
+	dir := t.TempDir()
+	writeSchema(t, dir, "sensor_data", sensorV1)
+	r, err := validator.NewRegistry(dir, validator.CompatBackward)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a new required property rejects payloads valid under v1
+	tighter := []byte(`{
+		"type": "object",
+		"required": ["temperature", "device"],
+		"properties": {"temperature": {"type": "number", "minimum": -50}}
+	}`)
+	_, err = r.Register("sensor_data", tighter, "")
+	var cerr *validator.CompatibilityError
+	if !errors.As(err, &cerr) || !errors.Is(err, validator.ErrIncompatibleSchema) {
+		t.Fatalf("expected CompatibilityError, got %v", err)
+	}
+	if len(cerr.Reasons) != 1 {
+		t.Fatalf("expected one reason, got %v", cerr.Reasons)
+	}
+
+	// the same change only narrows what v1 accepts, so it is forward compatible
+	if _, err := r.Register("sensor_data", tighter, validator.CompatForward); err != nil {
+		t.Fatalf("expected forward compatible schema to register, got %v", err)
+	}
+	if _, err := r.Register("sensor_data", []byte(`{"type": "string"}`), validator.CompatFull); err == nil {
+		t.Fatal("expected type change to fail full compatibility")
+	}
+	if _, err := r.Register("sensor_data", []byte(`{"type": "string"}`), validator.CompatNone); err != nil {
+		t.Fatalf("expected compatibility none to accept anything, got %v", err)
+	}
+}
+
+func TestSchemaValidatorResolvesSchemaVersion(t *testing.T) {
+	dir := t.TempDir()
+	writeSchema(t, dir, "sensor_data", sensorV1)
+	r, err := validator.NewRegistry(dir, validator.CompatNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Register("sensor_data", []byte(`{
+		"type": "object",
+		"required": ["celsius"],
+		"properties": {"celsius": {"type": "number"}}
+	}`), ""); err != nil {
+		t.Fatal(err)
+	}
+	v := validator.NewRegistryValidator(r)
+
+	legacy := pipeline.Event{Type: "sensor_data", Source: "iot", Data: map[string]interface{}{"temperature": 21}}
+	if err := v.Validate(context.Background(), legacy); err == nil {
+		t.Fatal("expected latest schema to reject legacy payload")
+	}
+
+	legacy.SchemaVersion = 1
+	if err := v.Validate(context.Background(), legacy); err != nil {
+		t.Fatalf("expected payload to match pinned version 1, got %v", err)
+	}
+
+	legacy.SchemaVersion = 9
+	fields := fieldSet(t, v.Validate(context.Background(), legacy))
+	if _, ok := fields["/schema_version"]; !ok {
+		t.Fatalf("expected /schema_version error, got %v", fields)
+	}
+}
@@ -0,0 +1,140 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/internal/storage"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestRetryPolicyBackoffIsCappedExponentialWithJitter(t *testing.T) {
+	p := pipeline.NewRetryPolicy(10, 10*time.Millisecond, 50*time.Millisecond)
+
+	ceilings := []time.Duration{10, 20, 40, 50, 50}
+	for i, ceiling := range ceilings {
+		attempt := i + 1
+		var max time.Duration
+		for n := 0; n < 200; n++ {
+			d := p.Backoff(attempt)
+			if d < 0 || d > ceiling*time.Millisecond {
+				t.Fatalf("Backoff(%d) = %s, want within [0, %dms]", attempt, d, ceiling)
+			}
+			if d > max {
+				max = d
+			}
+		}
+		// full jitter still reaches well past half the ceiling
+		if max < ceiling*time.Millisecond/2 {
+			t.Errorf("Backoff(%d) never exceeded %s in 200 draws", attempt, max)
+		}
+	}
+
+	huge := pipeline.NewRetryPolicy(100, time.Second, 0)
+	if d := huge.Backoff(80); d < 0 {
+		t.Errorf("Backoff overflowed: %s", d)
+	}
+}
+
+func TestRetryPolicyDoAndWait(t *testing.T) {
+	p := pipeline.NewRetryPolicy(4, time.Millisecond, 2*time.Millisecond)
+
+	calls := 0
+	err := p.Do(context.Background(), func(int) error {
+		calls++
+		return errors.New("flaky")
+	})
+	if err == nil || calls != 4 {
+		t.Errorf("retryable: calls = %d, err = %v; want 4 calls", calls, err)
+	}
+
+	calls = 0
+	err = p.Do(context.Background(), func(int) error {
+		calls++
+		return pipeline.Permanent(errors.New("bad row"))
+	})
+	if !pipeline.IsPermanent(err) || calls != 1 {
+		t.Errorf("permanent: calls = %d, err = %v; want 1 call", calls, err)
+	}
+
+	calls = 0
+	err = p.Do(context.Background(), func(attempt int) error {
+		calls++
+		if attempt < 3 {
+			return errors.New("flaky")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("recovering: calls = %d, err = %v", calls, err)
+	}
+
+	// Wait gives up as soon as ctx is done
+	slow := pipeline.NewRetryPolicy(2, time.Hour, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := slow.Wait(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait err = %v, want DeadlineExceeded", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Wait ignored the context")
+	}
+
+	if pipeline.ClassifyError(fmt.Errorf("store: %w", pipeline.ErrCircuitOpen)) != pipeline.ErrorRetryable {
+		t.Error("an open circuit should be retried once it lets trial calls through")
+	}
+}
+
+func TestClassifyMySQLError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want pipeline.ErrorClass
+	}{
+		{&mysql.MySQLError{Number: 1265, Message: "Data truncated for column 'type'"}, pipeline.ErrorPermanent},
+		{&mysql.MySQLError{Number: 1406, Message: "Data too long"}, pipeline.ErrorPermanent},
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, pipeline.ErrorRetryable},
+		{&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, pipeline.ErrorRetryable},
+		{&mysql.MySQLError{Number: 1040, Message: "Too many connections"}, pipeline.ErrorRetryable},
+		{fmt.Errorf("insert failed: %w", &mysql.MySQLError{Number: 3140}), pipeline.ErrorPermanent},
+		{mysql.ErrInvalidConn, pipeline.ErrorRetryable},
+		{pipeline.Permanent(storage.ErrUnknownEventType), pipeline.ErrorPermanent},
+		{context.Canceled, pipeline.ErrorPermanent},
+	}
+	for _, c := range cases {
+		if got := storage.ClassifyMySQLError(c.err); got != c.want {
+			t.Errorf("ClassifyMySQLError(%v) = %s, want %s", c.err, got, c.want)
+		}
+	}
+}
+
+func TestPipelineDoesNotRetryPermanentErrors(t *testing.T) {
+	backend := &switchStorage{err: pipeline.Permanent(errors.New("bad row"))}
+	dlq := &testmocks.MockDeadLetterSink{}
+	metrics := pipeline.NewMetrics()
+	cfg := &config.Config{
+		WorkerCount:      1,
+		QueueSize:        10,
+		MaxRetries:       5,
+		RetryBaseBackoff: time.Second,
+	}
+	p := pipeline.NewEventPipeline(backend, &pipeline.JSONProcessor{}, &validator.BasicValidator{}, metrics, cfg,
+		pipeline.WithDeadLetterSink(dlq))
+	defer p.Shutdown(context.Background())
+
+	p.Ingest(pipeline.Event{Type: "user_action", Source: "unit"})
+	waitFor(t, func() bool { return metrics.GetDeadLettered() == 1 })
+	if backend.count() != 1 {
+		t.Errorf("store calls = %d, want 1", backend.count())
+	}
+	if letters := dlq.All(); len(letters) != 1 || letters[0].Attempts != 1 {
+		t.Errorf("dead letters = %+v, want one after 1 attempt", letters)
+	}
+}
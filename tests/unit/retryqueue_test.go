@@ -0,0 +1,81 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRetryQueueKeepsWorkersFree(t *testing.T) {
+	badID := uuid.New().String()
+	store := &testmocks.BatchStorage{FailIDs: map[string]bool{badID: true}}
+	spill := &testmocks.MockDeadLetterSink{}
+	metrics := pipeline.NewMetrics()
+	cfg := &config.Config{
+		WorkerCount:      1,
+		QueueSize:        10,
+		MaxRetries:       3,
+		RetryBaseBackoff: 10 * time.Second,
+		RetryMaxBackoff:  10 * time.Second,
+	}
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, metrics, cfg,
+		pipeline.WithSpillSink(spill))
+
+	p.Ingest(pipeline.Event{ID: badID, Type: "user_action", Source: "unit"})
+	p.Ingest(pipeline.Event{Type: "user_action", Source: "unit"})
+
+	// the only worker moves on while the failed event waits for its retry
+	waitFor(t, func() bool { return metrics.GetProcessed() == 1 })
+	if p.RetryQueueDepth() != 1 || metrics.GetRetries() != 1 {
+		t.Errorf("retry queue depth = %d, retries = %d; want 1 and 1", p.RetryQueueDepth(), metrics.GetRetries())
+	}
+	if store.Calls() != 2 {
+		t.Errorf("store calls = %d, want 2", store.Calls())
+	}
+
+	// retries still waiting at the shutdown deadline are spilled
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	summary, err := p.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("shutdown err = %v, want deadline exceeded", err)
+	}
+	letters := spill.All()
+	if summary.Spilled != 1 || len(letters) != 1 || letters[0].Event.ID != badID {
+		t.Errorf("summary = %+v, spilled %+v; want the failed event spilled", summary, letters)
+	}
+	if p.RetryQueueDepth() != 0 {
+		t.Errorf("retry queue depth = %d after shutdown", p.RetryQueueDepth())
+	}
+}
+
+func TestRetryQueueDrainsOnShutdown(t *testing.T) {
+	store := &testmocks.FlakyStorage{ShouldFail: 2}
+	metrics := pipeline.NewMetrics()
+	cfg := &config.Config{
+		WorkerCount:      2,
+		QueueSize:        10,
+		MaxRetries:       3,
+		RetryBaseBackoff: 5 * time.Millisecond,
+	}
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, metrics, cfg)
+
+	p.Ingest(pipeline.Event{Type: "user_action", Source: "unit"})
+
+	// shutdown waits for pending retries instead of dropping them
+	summary, err := p.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.GetProcessed() != 1 || metrics.GetRetries() != 2 || summary.Spilled != 0 {
+		t.Errorf("processed = %d, retries = %d, summary = %+v; want the event stored after 2 retries",
+			metrics.GetProcessed(), metrics.GetRetries(), summary)
+	}
+}
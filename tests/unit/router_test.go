@@ -0,0 +1,204 @@
+package unit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/internal/storage"
+	"event-pipeline/tests/testmocks"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func routed(id, typ, source string, data map[string]interface{}) pipeline.ProcessedEvent {
+	return pipeline.ProcessedEvent{Event: pipeline.Event{ID: id, Type: typ, Source: source, Data: data}}
+}
+
+func storedIDs(s *testmocks.MockStorage) map[string]int {
+	ids := map[string]int{}
+	for _, e := range s.Events {
+		ids[e.ID]++
+	}
+	return ids
+}
+
+func TestRouterDispatchesByContent(t *testing.T) {
+	mysql, archive, logs := &testmocks.MockStorage{}, &testmocks.MockStorage{}, &testmocks.MockStorage{}
+	r, err := storage.NewRouter(storage.RouterConfig{
+		Sinks: map[string]storage.SinkConfig{
+			"mysql":   {Type: storage.SinkMySQL},
+			"archive": {Type: storage.SinkFile, Path: "unused"},
+			"logs":    {Type: storage.SinkFile, Path: "unused"},
+		},
+		Routes: []storage.Route{
+			{Name: "logs", Types: []string{"system_log"}, Sinks: []string{"logs"}},
+			{Name: "alerts", Data: map[string]interface{}{"route": "alerts"}, Sinks: []string{"mysql", "archive"}},
+			{Name: "mobile", Sources: []string{"ios", "android"}, Data: map[string]interface{}{"cart.action": []interface{}{"buy", "refund"}}, Sinks: []string{"archive"}},
+		},
+		Default: []string{"mysql"},
+	}, map[string]pipeline.Storage{"mysql": mysql, "archive": archive, "logs": logs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := pipeline.NewMetrics()
+	r.SetMetrics(metrics)
+
+	events := []pipeline.ProcessedEvent{
+		routed("log", "system_log", "api", nil),
+		routed("alert", "sensor_data", "api", map[string]interface{}{"route": "alerts"}),
+		routed("buy", "user_action", "ios", map[string]interface{}{"cart": map[string]interface{}{"action": "buy"}}),
+		routed("view", "user_action", "ios", map[string]interface{}{"cart": map[string]interface{}{"action": "view"}}),
+		routed("web", "user_action", "web", nil),
+	}
+	if err := r.Store(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		name string
+		sink *testmocks.MockStorage
+		want []string
+	}{
+		{"mysql", mysql, []string{"alert", "view", "web"}},
+		{"archive", archive, []string{"alert", "buy"}},
+		{"logs", logs, []string{"log"}},
+	}
+	for _, c := range checks {
+		got := storedIDs(c.sink)
+		if len(got) != len(c.want) {
+			t.Errorf("%s got %v, want %v", c.name, got, c.want)
+		}
+		for _, id := range c.want {
+			if got[id] != 1 {
+				t.Errorf("%s got %v, want %s once", c.name, got, id)
+			}
+		}
+		if st := metrics.SinkStats()[c.name]; st.Stored != uint64(len(c.want)) || st.Failed != 0 {
+			t.Errorf("%s stats = %+v", c.name, st)
+		}
+	}
+
+	// without a default, unmatched events fail
+	r, err = storage.NewRouter(storage.RouterConfig{
+		Sinks:  map[string]storage.SinkConfig{"logs": {Type: storage.SinkMySQL}},
+		Routes: []storage.Route{{Types: []string{"system_log"}, Sinks: []string{"logs"}}},
+	}, map[string]pipeline.Storage{"logs": logs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Store(context.Background(), []pipeline.ProcessedEvent{routed("x", "user_action", "web", nil)}); !errors.Is(err, storage.ErrNoRoute) {
+		t.Errorf("err = %v, want ErrNoRoute", err)
+	}
+
+	if _, err := storage.NewRouter(storage.RouterConfig{
+		Sinks:  map[string]storage.SinkConfig{"mysql": {Type: storage.SinkMySQL}},
+		Routes: []storage.Route{{Sinks: []string{"nope"}}},
+	}, map[string]pipeline.Storage{"mysql": mysql}); err == nil {
+		t.Error("route to an unknown sink accepted")
+	}
+}
+
+func TestRouterRetriesEachSinkIndependently(t *testing.T) {
+	mysql := &testmocks.MockStorage{}
+	flaky := &testmocks.FlakyStorage{ShouldFail: 1}
+	down := &testmocks.FlakyStorage{AlwaysFailIDs: map[string]bool{"a": true}}
+	r, err := storage.NewRouter(storage.RouterConfig{
+		Sinks: map[string]storage.SinkConfig{
+			"mysql":    {Type: storage.SinkMySQL, MaxRetries: 1},
+			"flaky":    {Type: storage.SinkMySQL, MaxRetries: 2, BackoffMS: 1},
+			"down":     {Type: storage.SinkMySQL, MaxRetries: 2, BackoffMS: 1},
+			"optional": {Type: storage.SinkMySQL, MaxRetries: 1, Optional: true},
+		},
+		Default: []string{"mysql", "flaky", "optional"},
+		Routes:  []storage.Route{{Sources: []string{"critical"}, Sinks: []string{"mysql", "down"}}},
+	}, map[string]pipeline.Storage{
+		"mysql": mysql, "flaky": flaky, "down": down,
+		"optional": &testmocks.FlakyStorage{AlwaysFailIDs: map[string]bool{"b": true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := pipeline.NewMetrics()
+	r.SetMetrics(metrics)
+
+	// flaky recovers on its second attempt, optional failing does not
+	// fail the event
+	if err := r.Store(context.Background(), []pipeline.ProcessedEvent{routed("b", "user_action", "web", nil)}); err != nil {
+		t.Fatalf("Store = %v, want nil", err)
+	}
+	if st := metrics.SinkStats()["flaky"]; st.Stored != 1 || st.Retries != 1 {
+		t.Errorf("flaky stats = %+v", st)
+	}
+	if st := metrics.SinkStats()["optional"]; st.Failed != 1 {
+		t.Errorf("optional stats = %+v", st)
+	}
+
+	// down never takes a; when the pipeline retries the event, mysql is
+	// not written again
+	for i := 0; i < 2; i++ {
+		if err := r.Store(context.Background(), []pipeline.ProcessedEvent{routed("a", "user_action", "critical", nil)}); err == nil {
+			t.Fatal("Store succeeded with a required sink down")
+		}
+	}
+	if got := storedIDs(mysql); got["a"] != 1 || got["b"] != 1 {
+		t.Errorf("mysql got %v, want a and b once", got)
+	}
+	if st := metrics.SinkStats()["down"]; st.Failed != 2 || st.Retries != 2 {
+		t.Errorf("down stats = %+v", st)
+	}
+}
+
+func TestRouterLeavesOpenCircuitsToThePipeline(t *testing.T) {
+	open := &switchStorage{err: &pipeline.CircuitOpenError{Name: "archive"}}
+	r, err := storage.NewRouter(storage.RouterConfig{
+		Sinks:   map[string]storage.SinkConfig{"archive": {Type: storage.SinkMySQL, MaxRetries: 3, BackoffMS: 1}},
+		Default: []string{"archive"},
+	}, map[string]pipeline.Storage{"archive": open})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Store(context.Background(), []pipeline.ProcessedEvent{routed("a", "user_action", "web", nil)})
+	if !errors.Is(err, pipeline.ErrCircuitOpen) {
+		t.Fatalf("Store = %v, want ErrCircuitOpen", err)
+	}
+	if open.count() != 1 {
+		t.Errorf("sink calls = %d, want 1", open.count())
+	}
+}
+
+func TestFileStorageAppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive", "events.jsonl")
+	fs, err := storage.NewFileStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	for _, id := range []string{"a", "b"} {
+		if err := fs.Store(context.Background(), []pipeline.ProcessedEvent{routed(id, "system_log", "api", map[string]interface{}{"msg": "hi"})}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e pipeline.ProcessedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, e.ID)
+	}
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("archived ids = %v, want [a b]", ids)
+	}
+}
@@ -0,0 +1,145 @@
+package unit
+
+import (
+	"context"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRules = `{
+	"max_payload_bytes": 200,
+	"max_future_skew": "5m",
+	"max_past_skew": "1h",
+	"types": {
+		"sensor_data": {
+			"sources": ["iot"],
+			"required": ["temperature", "device.id"],
+			"ranges": {"temperature": {"min": -50, "max": 150}},
+			"patterns": {"device.id": "^dev-[0-9]+$"}
+		},
+		"user_action": {}
+	}
+}`
+
+func writeRules(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRuleValidatorChecksEveryRule(t *testing.T) {
+	v, err := validator.NewRuleValidator(writeRules(t, testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := pipeline.Event{
+		Type:      "sensor_data",
+		Source:    "iot",
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"temperature": 21.5,
+			"device":      map[string]interface{}{"id": "dev-7"},
+		},
+	}
+	if err := v.Validate(context.Background(), valid); err != nil {
+		t.Fatalf("expected valid event, got %v", err)
+	}
+
+	bad := pipeline.Event{
+		Type:      "sensor_data",
+		Source:    "web",
+		Timestamp: time.Now().Add(time.Hour),
+		Data: map[string]interface{}{
+			"temperature": 500,
+			"device":      map[string]interface{}{"id": "printer"},
+		},
+	}
+	fields := fieldSet(t, v.Validate(context.Background(), bad))
+	for _, f := range []string{"/source", "/timestamp", "/data/temperature", "/data/device/id"} {
+		if _, ok := fields[f]; !ok {
+			t.Errorf("expected error for %s, got %v", f, fields)
+		}
+	}
+
+	stale := pipeline.Event{Type: "user_action", Source: "web", Timestamp: time.Now().Add(-2 * time.Hour)}
+	if fields := fieldSet(t, v.Validate(context.Background(), stale)); !strings.Contains(fields["/timestamp"], "past") {
+		t.Errorf("expected past skew error, got %v", fields)
+	}
+
+	unknown := pipeline.Event{Type: "purchase", Source: "web"}
+	if _, ok := fieldSet(t, v.Validate(context.Background(), unknown))["/type"]; !ok {
+		t.Error("expected unlisted type to be rejected")
+	}
+
+	big := pipeline.Event{Type: "user_action", Source: "web", Data: map[string]interface{}{"blob": strings.Repeat("x", 300)}}
+	if _, ok := fieldSet(t, v.Validate(context.Background(), big))["/data"]; !ok {
+		t.Error("expected oversized payload to be rejected")
+	}
+
+	missing := pipeline.Event{Type: "sensor_data", Source: "iot", Data: map[string]interface{}{}}
+	fields = fieldSet(t, v.Validate(context.Background(), missing))
+	if fields["/data/temperature"] != "is required" || fields["/data/device/id"] != "is required" {
+		t.Errorf("expected required key errors, got %v", fields)
+	}
+}
+
+func TestRuleValidatorReloadKeepsRulesOnError(t *testing.T) {
+	path := writeRules(t, `{"types": {"user_action": {}}}`)
+	v, err := validator.NewRuleValidator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := pipeline.Event{Type: "sensor_data", Source: "iot"}
+	if err := v.Validate(context.Background(), ev); err == nil {
+		t.Fatal("expected sensor_data to be rejected")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"types": {"user_action": {}, "sensor_data": {}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Validate(context.Background(), ev); err != nil {
+		t.Fatalf("expected reloaded rules to allow sensor_data, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"typos": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Reload(); err == nil {
+		t.Fatal("expected unknown field to fail the reload")
+	}
+	if err := v.Validate(context.Background(), ev); err != nil {
+		t.Fatalf("expected previous rules to stay active, got %v", err)
+	}
+}
+
+func TestChainMergesFieldErrors(t *testing.T) {
+	rules, err := validator.NewRuleValidator(writeRules(t, `{"types": {"user_action": {}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := validator.NewChain(&validator.BasicValidator{}, nil, rules)
+
+	fields := fieldSet(t, chain.Validate(context.Background(), pipeline.Event{Type: "purchase", ID: "nope"}))
+	for _, f := range []string{"/type", "/source", "/id"} {
+		if _, ok := fields[f]; !ok {
+			t.Errorf("expected error for %s, got %v", f, fields)
+		}
+	}
+
+	ok := pipeline.Event{Type: "user_action", Source: "web"}
+	if err := chain.Validate(context.Background(), ok); err != nil {
+		t.Fatalf("expected valid event, got %v", err)
+	}
+}
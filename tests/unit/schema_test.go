@@ -0,0 +1,109 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSchema(t *testing.T, dir, eventType, body string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, eventType+".json"), []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func fieldSet(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var verr *pipeline.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *pipeline.ValidationError, got %T (%v)", err, err)
+	}
+	out := map[string]string{}
+	for _, f := range verr.Fields {
+		out[f.Field] = f.Message
+	}
+	return out
+}
+
+func TestSchemaValidatorReportsAllViolations(t *testing.T) {
+	dir := t.TempDir()
+	writeSchema(t, dir, "sensor_data", `{
+		"type": "object",
+		"required": ["temperature", "device"],
+		"properties": {
+			"temperature": {"type": "number"},
+			"readings": {"type": "array", "items": {"type": "integer", "minimum": 0}},
+			"meta/info": {"type": "string", "maxLength": 3}
+		}
+	}`)
+
+	val, err := validator.NewSchemaValidator(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := pipeline.Event{Type: "sensor_data", Source: "iot", Data: map[string]interface{}{
+		"temperature": 21.5, "device": "d1", "readings": []int{1, 2},
+	}}
+	if err := val.Validate(context.Background(), valid); err != nil {
+		t.Errorf("expected valid event, got %v", err)
+	}
+
+	invalid := pipeline.Event{Type: "sensor_data", Data: map[string]interface{}{
+		"temperature": "hot",
+		"readings":    []interface{}{1.0, -2.0},
+		"meta/info":   "toolong",
+	}}
+	fields := fieldSet(t, val.Validate(context.Background(), invalid))
+	for _, ptr := range []string{"/source", "/data/temperature", "/data/device", "/data/readings/1", "/data/meta~1info"} {
+		if _, ok := fields[ptr]; !ok {
+			t.Errorf("expected violation at %s, got %v", ptr, fields)
+		}
+	}
+
+	// types without a schema only get the basic checks unless required
+	other := pipeline.Event{Type: "user_action", Source: "web"}
+	if err := val.Validate(context.Background(), other); err != nil {
+		t.Errorf("expected type without schema to pass, got %v", err)
+	}
+	val.RequireSchema = true
+	if _, ok := fieldSet(t, val.Validate(context.Background(), other))["/type"]; !ok {
+		t.Error("expected /type violation when a schema is required")
+	}
+}
+
+func TestSchemaValidatorReload(t *testing.T) {
+	dir := t.TempDir()
+	writeSchema(t, dir, "sensor_data", `{"type": "object"}`)
+
+	val, err := validator.NewSchemaValidator(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := pipeline.Event{Type: "sensor_data", Source: "iot", Data: map[string]interface{}{}}
+	if err := val.Validate(context.Background(), ev); err != nil {
+		t.Fatalf("expected valid event, got %v", err)
+	}
+
+	writeSchema(t, dir, "sensor_data", `{"type": "object", "required": ["temperature"]}`)
+	if err := val.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := val.Validate(context.Background(), ev); err == nil {
+		t.Error("expected reloaded schema to require temperature")
+	}
+
+	// a broken schema keeps the previous set active
+	writeSchema(t, dir, "sensor_data", `{"type": "nonsense"}`)
+	if err := val.Reload(); err == nil {
+		t.Error("expected reload to fail on invalid schema")
+	}
+	if err := val.Validate(context.Background(), ev); err == nil {
+		t.Error("expected previous schema to stay active")
+	}
+}
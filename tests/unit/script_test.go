@@ -0,0 +1,163 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/processor"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExprEvaluates(t *testing.T) {
+	ev := pipeline.Event{
+		ID:     "e1",
+		Type:   "sensor_data",
+		Source: "mobile",
+		Data: map[string]interface{}{
+			"temperature": 21.5,
+			"action":      "Click",
+			"tags":        []interface{}{"a", "b"},
+			"user":        map[string]interface{}{"email": "jane@example.com"},
+		},
+	}
+
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"7 % 4 - -1", 4.0},
+		{"data.temperature * 9 / 5 + 32", 70.7},
+		{"'id-' + id + '/' + 3", "id-e1/3"},
+		{"lower(data.action) in ['click', 'tap']", true},
+		{"'b' in data.tags && len(data.tags) == 2", true},
+		{"data.missing.deeper", nil},
+		{"has(data.missing) || has(data.user.email)", true},
+		{"source == 'mobile' ? upper(type) : 'other'", "SENSOR_DATA"},
+		{"matches(data.user.email, '^[a-z]+@example\\\\.com$')", true},
+		{"endsWith(data.user['email'], '.com') && !startsWith(id, 'x')", true},
+		{"int('42.9') + number(true)", 43.0},
+	}
+	for _, c := range cases {
+		e, err := processor.CompileExpr(c.src)
+		if err != nil {
+			t.Errorf("%s: compile: %v", c.src, err)
+			continue
+		}
+		got, err := e.Eval(context.Background(), ev, 0)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s = %#v, want %#v", c.src, got, c.want)
+		}
+	}
+
+	for _, src := range []string{"1 +", "foo + 1", "exec('rm')", "len(1, 2)", "matches(id, '(')", "data.x = 1"} {
+		if _, err := processor.CompileExpr(src); err == nil {
+			t.Errorf("%s: compiled, want an error", src)
+		}
+	}
+
+	// the event itself is never modified
+	if ev.Data["action"] != "Click" {
+		t.Errorf("expression modified the event: %v", ev.Data)
+	}
+}
+
+func TestExprLimits(t *testing.T) {
+	e, err := processor.CompileExpr(strings.Repeat("1 + ", 200) + "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Eval(context.Background(), pipeline.Event{}, 50); !errors.Is(err, processor.ErrStepLimit) {
+		t.Fatalf("err = %v, want ErrStepLimit", err)
+	}
+	if got, err := e.Eval(context.Background(), pipeline.Event{}, 0); err != nil || got != 201.0 {
+		t.Fatalf("got %v, %v; want 201", got, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := e.Eval(ctx, pipeline.Event{}, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestScriptsFilterAndDeriveFields(t *testing.T) {
+	s, err := processor.ParseScripts([]byte(`{
+		"on_error": "skip",
+		"scripts": {
+			"*": {"set": [{"field": "route", "expr": "'default'"}]},
+			"sensor_data": {
+				"filter": "has(data.temperature) && data.temperature > -100",
+				"set": [
+					{"field": "temperature_f", "expr": "data.temperature * 9 / 5 + 32"},
+					{"field": "alert.level", "expr": "data.temperature_f > 100 ? 'high' : 'normal'"},
+					{"field": "route", "expr": "data.alert.level == 'high' ? 'alerts' : data.route"}
+				]
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.OnError() != pipeline.PolicySkip {
+		t.Errorf("OnError() = %q", s.OnError())
+	}
+
+	in := pipeline.Event{Type: "sensor_data", Data: map[string]interface{}{"temperature": 40.0}}
+	out, err := s.Apply(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"temperature":   40.0,
+		"temperature_f": 104.0,
+		"alert":         map[string]interface{}{"level": "high"},
+		"route":         "alerts",
+	}
+	if len(out) != 1 || !reflect.DeepEqual(out[0].Data, want) {
+		t.Fatalf("Apply = %+v, want data %v", out, want)
+	}
+	if len(in.Data) != 1 {
+		t.Errorf("script modified the input event: %v", in.Data)
+	}
+
+	out, err = s.Apply(context.Background(), pipeline.Event{Type: "sensor_data", Data: map[string]interface{}{}})
+	if err != nil || len(out) != 0 {
+		t.Fatalf("filtered event: got %v, %v; want it dropped", out, err)
+	}
+	if _, err := s.Process(context.Background(), pipeline.Event{Type: "sensor_data"}); !errors.Is(err, pipeline.ErrEventDropped) {
+		t.Errorf("Process err = %v, want ErrEventDropped", err)
+	}
+
+	out, err = s.Apply(context.Background(), pipeline.Event{Type: "system_log", Data: map[string]interface{}{}})
+	if err != nil || out[0].Data["route"] != "default" {
+		t.Fatalf("wildcard script: got %v, %v", out, err)
+	}
+
+	bad := []string{
+		`{"scripts": {"x": {"filter": "data.a +"}}}`,
+		`{"scripts": {"x": {"set": [{"field": "", "expr": "1"}]}}}`,
+		`{"on_error": "retry", "scripts": {}}`,
+		`{"scripts": {}, "timeout": 5}`,
+	}
+	for _, b := range bad {
+		if _, err := processor.ParseScripts([]byte(b)); err == nil {
+			t.Errorf("ParseScripts(%s) succeeded, want an error", b)
+		}
+	}
+
+	nonBool, err := processor.ParseScripts([]byte(`{"scripts": {"x": {"filter": "data.a"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nonBool.Apply(context.Background(), pipeline.Event{Type: "x", Data: map[string]interface{}{"a": 1.0}}); err == nil {
+		t.Error("non-boolean filter succeeded, want an error")
+	}
+}
@@ -0,0 +1,147 @@
+package unit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/processor"
+	"reflect"
+	"testing"
+)
+
+func TestTransformAppliesOperations(t *testing.T) {
+	tr, err := processor.ParseTransform([]byte(`{
+		"transforms": {
+			"*": [{"op": "delete", "field": "debug"}],
+			"user_action": [
+				{"op": "rename", "from": "user.mail", "to": "email"},
+				{"op": "copy", "from": "user.id", "to": "uid"},
+				{"op": "set", "field": "meta.version", "value": 2},
+				{"op": "hash", "field": "email", "salt": "s"},
+				{"op": "mask", "field": "ip"},
+				{"op": "mask", "field": "card", "keep_last": 2},
+				{"op": "coerce", "field": "count", "to": "integer"},
+				{"op": "coerce", "field": "at", "to": "rfc3339"},
+				{"op": "flatten", "field": "user", "separator": "_"}
+			]
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := pipeline.Event{
+		Type:   "user_action",
+		Source: "web",
+		Data: map[string]interface{}{
+			"debug": true,
+			"user":  map[string]interface{}{"mail": "jane@example.com", "id": 7, "geo": map[string]interface{}{"cc": "DE"}},
+			"ip":    "203.0.113.42",
+			"card":  "4111111111111111",
+			"count": "12.7",
+			"at":    1700000000000,
+		},
+	}
+	out, err := tr.Apply(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := out[0].Data
+
+	sum := sha256.Sum256([]byte("sjane@example.com"))
+	want := map[string]interface{}{
+		"email":       hex.EncodeToString(sum[:]),
+		"uid":         float64(7),
+		"meta":        map[string]interface{}{"version": float64(2)},
+		"ip":          "203.0.113.0",
+		"card":        "**************11",
+		"count":       float64(12),
+		"at":          "2023-11-14T22:13:20Z",
+		"user_id":     float64(7),
+		"user_geo_cc": "DE",
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("unexpected data\n got: %v\nwant: %v", data, want)
+	}
+
+	// the input payload is left untouched
+	if _, ok := in.Data["debug"]; !ok {
+		t.Error("expected the original event data to be unchanged")
+	}
+
+	// other types only get the "*" operations
+	other, _ := tr.Apply(context.Background(), pipeline.Event{Type: "system_log", Data: map[string]interface{}{"debug": 1, "ip": "10.0.0.1"}})
+	if !reflect.DeepEqual(other[0].Data, map[string]interface{}{"ip": "10.0.0.1"}) {
+		t.Errorf("unexpected data for system_log: %v", other[0].Data)
+	}
+}
+
+func TestTransformErrors(t *testing.T) {
+	if _, err := processor.ParseTransform([]byte(`{"transforms": {"*": [{"op": "explode"}]}}`)); err == nil {
+		t.Error("expected unknown op to be rejected")
+	}
+	if _, err := processor.ParseTransform([]byte(`{"on_error": "retry", "transforms": {}}`)); err == nil {
+		t.Error("expected unknown policy to be rejected")
+	}
+
+	tr, err := processor.NewTransform(processor.TransformConfig{
+		Transforms: map[string][]processor.Operation{
+			"sensor_data": {{Op: processor.OpCoerce, Field: "temperature", To: "number"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.Process(context.Background(), pipeline.Event{Type: "sensor_data", Data: map[string]interface{}{"temperature": "warm"}}); err == nil {
+		t.Error("expected failed coercion to return an error")
+	}
+	pe, err := tr.Process(context.Background(), pipeline.Event{Type: "sensor_data", Data: map[string]interface{}{"temperature": " 21.5 "}})
+	if err != nil || pe.Data["temperature"] != 21.5 {
+		t.Errorf("expected coerced temperature, got %v (%v)", pe, err)
+	}
+}
+
+func TestTransformSkipStillRedacts(t *testing.T) {
+	tr, err := processor.ParseTransform([]byte(`{
+		"on_error": "skip",
+		"transforms": {
+			"user_action": [
+				{"op": "coerce", "field": "count", "to": "integer"},
+				{"op": "rename", "from": "mail", "to": "meta.mail"},
+				{"op": "mask", "field": "ip"},
+				{"op": "hash", "field": "mail"}
+			]
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := pipeline.NewProcessorChain(pipeline.ChainStage{Name: "transform", Stage: tr, OnError: tr.OnError()})
+
+	// the coercion fails and the rename is blocked by a scalar meta
+	ev := pipeline.NewEvent(pipeline.Event{
+		Type:   "user_action",
+		Source: "web",
+		Data: map[string]interface{}{
+			"count": "many",
+			"meta":  "v1",
+			"mail":  "jane@example.com",
+			"ip":    "203.0.113.42",
+		},
+	})
+	out, err := chain.ProcessAll(context.Background(), ev)
+	if err != nil || len(out) != 1 {
+		t.Fatalf("expected the event to pass under skip, got %v %v", out, err)
+	}
+	sum := sha256.Sum256([]byte("jane@example.com"))
+	want := map[string]interface{}{
+		"count": "many",
+		"meta":  "v1",
+		"mail":  hex.EncodeToString(sum[:]),
+		"ip":    "203.0.113.0",
+	}
+	if !reflect.DeepEqual(out[0].Data, want) {
+		t.Errorf("unexpected data\n got: %v\nwant: %v", out[0].Data, want)
+	}
+}
@@ -2,6 +2,7 @@ package unit
 
 import (
 	"context"
+	"errors"
 	"event-pipeline/internal/pipeline"
 	"event-pipeline/pkg/validator"
 	"testing"
@@ -64,3 +65,31 @@ func TestValidatorAcceptsValidUUID(t *testing.T) {
 		t.Errorf("expected valid UUID, got error: %v", err)
 	}
 }
+
+func TestValidatorReportsAllFieldErrors(t *testing.T) {
+	val := &validator.BasicValidator{}
+
+	err := val.Validate(context.Background(), pipeline.Event{ID: "bad"})
+
+	var verr *pipeline.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected *pipeline.ValidationError, got %T", err)
+	}
+	if len(verr.Fields) != 3 {
+		t.Errorf("expected 3 field errors, got %+v", verr.Fields)
+	}
+}
+
+func TestValidatorRejectsUnknownType(t *testing.T) {
+	val := &validator.BasicValidator{Types: pipeline.NewEventTypes("user_action", "sensor_data")}
+
+	if err := val.Validate(context.Background(), pipeline.Event{Type: "sensor_data", Source: "iot"}); err != nil {
+		t.Fatalf("expected known type to pass, got %v", err)
+	}
+
+	err := val.Validate(context.Background(), pipeline.Event{Type: "purchase", Source: "web"})
+	var verr *pipeline.ValidationError
+	if !errors.As(err, &verr) || len(verr.Fields) != 1 || verr.Fields[0].Field != "/type" {
+		t.Fatalf("expected a /type error, got %v", err)
+	}
+}
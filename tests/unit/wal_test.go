@@ -0,0 +1,215 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"event-pipeline/internal/config"
+	"event-pipeline/internal/pipeline"
+	"event-pipeline/pkg/validator"
+	"event-pipeline/tests/testmocks"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWALRecoversUnackedEvents(t *testing.T) {
+	dir := t.TempDir()
+
+	wal, err := pipeline.OpenWAL(dir, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seqs []uint64
+	for _, typ := range []string{"user_action", "sensor_data", "system_log"} {
+		seq, err := wal.Append(pipeline.NewEvent(pipeline.Event{Type: typ, Source: "web"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, seq)
+	}
+	if err := wal.Ack(seqs[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a crash mid-write
+	segs, _ := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	f, err := os.OpenFile(segs[len(segs)-1], os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"op":"append","seq":99,"ev`)
+	f.Close()
+
+	wal, err = pipeline.OpenWAL(dir, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	pending := wal.Pending()
+	if len(pending) != 2 {
+		t.Fatalf("expected 2 unacked events, got %d", len(pending))
+	}
+	if pending[0].Type != "user_action" || pending[1].Type != "system_log" {
+		t.Errorf("expected unacked events in append order, got %s, %s", pending[0].Type, pending[1].Type)
+	}
+
+	// sequence numbers keep growing across restarts
+	seq, err := wal.Append(pipeline.NewEvent(pipeline.Event{Type: "user_action", Source: "web"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq <= seqs[2] {
+		t.Errorf("expected seq > %d after reopen, got %d", seqs[2], seq)
+	}
+}
+
+func TestWALRemovesFullyAckedSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	// tiny segments → one append per segment
+	wal, err := pipeline.OpenWAL(dir, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	var seqs []uint64
+	for i := 0; i < 5; i++ {
+		seq, err := wal.Append(pipeline.NewEvent(pipeline.Event{Type: "user_action", Source: "web"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, seq)
+	}
+	for _, seq := range seqs {
+		if err := wal.Ack(seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	segs, _ := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	if len(segs) != 1 {
+		t.Errorf("expected only the active segment to remain, got %d", len(segs))
+	}
+	if wal.Unacked() != 0 {
+		t.Errorf("expected 0 unacked, got %d", wal.Unacked())
+	}
+}
+
+func TestWALAppendSurvivesFailedRotation(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := pipeline.OpenWAL(dir, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a fresh log writes segment 1; segment 2 cannot be opened
+	next := filepath.Join(dir, "wal-00000000000000000002.log")
+	if err := os.Mkdir(next, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := wal.Append(pipeline.NewEvent(pipeline.Event{Type: "user_action", Source: "web"})); err != nil {
+			t.Fatalf("append %d: %v", i, err)
+		}
+	}
+	wal.Close()
+	os.Remove(next)
+
+	wal, err = pipeline.OpenWAL(dir, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	if got := len(wal.Pending()); got != 2 {
+		t.Errorf("expected both appends on disk, got %d", got)
+	}
+}
+
+func TestPipelineReplaysWALOnStartup(t *testing.T) {
+	dir := t.TempDir()
+
+	// a previous run accepted an event and crashed before storing it
+	wal, err := pipeline.OpenWAL(dir, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost := pipeline.NewEvent(pipeline.Event{Type: "user_action", Source: "web"})
+	if _, err := wal.Append(lost); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	wal, err = pipeline.OpenWAL(dir, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	store := &testmocks.MockStorage{}
+	metrics := pipeline.NewMetrics()
+	cfg := &config.Config{
+		WorkerCount:      1,
+		QueueSize:        100,
+		MaxRetries:       3,
+		RetryBaseBackoff: 10 * time.Millisecond,
+	}
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, metrics, cfg,
+		pipeline.WithWAL(wal))
+
+	if err := p.Ingest(pipeline.Event{Type: "sensor_data", Source: "iot"}); err != nil {
+		t.Fatal(err)
+	}
+	p.Shutdown(context.Background())
+
+	if len(store.Events) != 2 || store.Events[0].ID != lost.ID {
+		t.Fatalf("expected recovered event %s to be stored first, got %+v", lost.ID, store.Events)
+	}
+	if metrics.GetRecovered() != 1 {
+		t.Errorf("expected recovered=1, got %d", metrics.GetRecovered())
+	}
+	if wal.Unacked() != 0 {
+		t.Errorf("expected every stored event to be acked, got %d unacked", wal.Unacked())
+	}
+}
+
+func TestWALKeepsEventsWhoseDeadLetterWriteFailed(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := pipeline.OpenWAL(dir, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := pipeline.NewEvent(pipeline.Event{Type: "user_action", Source: "web"})
+	bad := pipeline.NewEvent(pipeline.Event{Type: "user_action", Source: "web"})
+	store := &testmocks.FlakyStorage{AlwaysFailIDs: map[string]bool{bad.ID: true}}
+	sink := &testmocks.MockDeadLetterSink{Err: errors.New("dead letter table unavailable")}
+	cfg := &config.Config{WorkerCount: 1, QueueSize: 10, MaxRetries: 1}
+	p := pipeline.NewEventPipeline(store, &testmocks.FastProcessor{}, &validator.BasicValidator{}, pipeline.NewMetrics(), cfg,
+		pipeline.WithWAL(wal), pipeline.WithDeadLetterSink(sink))
+
+	for _, ev := range []pipeline.Event{ok, bad} {
+		if err := p.Ingest(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Shutdown(context.Background())
+	wal.Close()
+
+	// the event that could not be dead-lettered is redelivered on restart
+	wal, err = pipeline.OpenWAL(dir, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	pending := wal.Pending()
+	if len(pending) != 1 || pending[0].ID != bad.ID {
+		t.Fatalf("expected only %s to stay unacked, got %+v", bad.ID, pending)
+	}
+}
@@ -1,6 +1,7 @@
 package unit
 
 import (
+	"context"
 	"event-pipeline/internal/config"
 	"event-pipeline/internal/pipeline"
 	"event-pipeline/pkg/validator"
@@ -24,7 +25,7 @@ func TestWorkerRetriesOnStorageFailure(t *testing.T) {
 	}
 
 	p := pipeline.NewEventPipeline(store, proc, val, metrics, cfg)
-	defer p.Shutdown()
+	defer p.Shutdown(context.Background())
 
 	p.Ingest(pipeline.Event{Type: "test_event", Source: "unit"})
 